@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/adopt"
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/models"
+
+	"github.com/spf13/cobra"
+)
+
+func NewAdoptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "adopt",
+		Short: "Add packages installed outside of keg to keg.yml",
+		Long: `Add the top-level packages installed with brew but missing from keg.yml.
+
+Packages are found with 'brew leaves', so dependencies pulled in by other
+formulae are left out. You are asked about each package unless --all is set.
+
+Examples:
+  keg adopt               # Pick which unmanaged packages to add
+  keg adopt --all         # Add every unmanaged package
+  keg adopt --group cli   # Tag the adopted packages with the cli group`,
+		Annotations: dryRunnable,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			all, err := cmd.Flags().GetBool("all")
+			if err != nil {
+				return err
+			}
+			groups, err := cmd.Flags().GetStringSlice("group")
+			if err != nil {
+				return err
+			}
+
+			return adopt.New(cfg, nil).Execute(cmd.Context(), all, groups)
+		},
+	}
+
+	cmd.Flags().BoolP("all", "a", false, "Add every unmanaged package without asking")
+	cmd.Flags().StringSliceP("group", "g", nil, "Tag the adopted packages with these groups")
+	return cmd
+}
@@ -0,0 +1,138 @@
+package adopt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+// scriptedPrompter answers Confirm from a map keyed by question.
+type scriptedPrompter struct {
+	answers map[string]bool
+	err     error
+}
+
+func (s *scriptedPrompter) Confirm(q string) (bool, error) { return s.answers[q], s.err }
+func (s *scriptedPrompter) Prompt(string) (string, error)  { return "", s.err }
+
+func newTestAdopter(t *testing.T, p *scriptedPrompter) (*Adopter, *[]*models.Config) {
+	t.Helper()
+
+	var saved []*models.Config
+	oldSave := saveConfig
+	saveConfig = func(cfg *models.Config) error {
+		saved = append(saved, cfg)
+		return nil
+	}
+	t.Cleanup(func() { saveConfig = oldSave })
+
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|leaves", []byte("ripgrep\nhashicorp/tap/terraform\njq\nfd\n"), nil)
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "ripgrep", Binary: "rg"},
+		{Command: "jq", Optional: true},
+	}}
+	a := New(cfg, mr)
+	a.Prompter = p
+	return a, &saved
+}
+
+func commands(cfg *models.Config) []string {
+	out := make([]string, 0, len(cfg.Packages))
+	for _, p := range cfg.Packages {
+		out = append(out, p.Command)
+	}
+	return out
+}
+
+func TestUnmanaged_SkipsManifestPackages(t *testing.T) {
+	a, _ := newTestAdopter(t, &scriptedPrompter{})
+
+	got, err := a.Unmanaged()
+	if err != nil {
+		t.Fatalf("Unmanaged: %v", err)
+	}
+	want := []string{"fd", "hashicorp/tap/terraform"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		all     bool
+		answers map[string]bool
+		want    []string
+		saves   int
+	}{
+		{
+			name:  "all adopts every leaf",
+			all:   true,
+			want:  []string{"ripgrep", "jq", "fd", "hashicorp/tap/terraform"},
+			saves: 1,
+		},
+		{
+			name:    "interactive adopts the confirmed leaves",
+			answers: map[string]bool{"Add hashicorp/tap/terraform to keg.yml?": true},
+			want:    []string{"ripgrep", "jq", "hashicorp/tap/terraform"},
+			saves:   1,
+		},
+		{
+			name: "nothing confirmed leaves keg.yml alone",
+			want: []string{"ripgrep", "jq"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, saved := newTestAdopter(t, &scriptedPrompter{answers: tt.answers})
+
+			if err := a.Execute(context.Background(), tt.all, nil); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if got := commands(a.Config); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("packages = %v, want %v", got, tt.want)
+			}
+			if len(*saved) != tt.saves {
+				t.Fatalf("expected %d save(s), got %d", tt.saves, len(*saved))
+			}
+		})
+	}
+}
+
+func TestExecute_Groups(t *testing.T) {
+	a, _ := newTestAdopter(t, &scriptedPrompter{})
+
+	if err := a.Execute(context.Background(), true, []string{"cli"}); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	for _, p := range a.Config.Packages[2:] {
+		if !p.InAnyGroup([]string{"cli"}) {
+			t.Fatalf("%s was not tagged with the cli group", p.Command)
+		}
+	}
+}
+
+func TestExecute_PromptError(t *testing.T) {
+	a, saved := newTestAdopter(t, &scriptedPrompter{err: errors.New("EOF")})
+
+	if err := a.Execute(context.Background(), false, nil); err == nil {
+		t.Fatalf("expected the prompt error to be returned")
+	}
+	if len(*saved) != 0 {
+		t.Fatalf("keg.yml must not be saved after a prompt error")
+	}
+}
@@ -0,0 +1,136 @@
+package adopt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/MrSnakeDoc/keg/internal/core"
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/manifest"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/prompter"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+	"github.com/MrSnakeDoc/keg/internal/versions"
+)
+
+var saveConfig = globalconfig.SaveConfig
+
+type Adopter struct {
+	*core.Base
+	Prompter prompter.Prompter
+}
+
+func New(config *models.Config, r runner.CommandRunner) *Adopter {
+	if r == nil {
+		r = runner.New()
+	}
+
+	return &Adopter{
+		Base:     core.NewBase(config, r),
+		Prompter: prompter.New(os.Stdin, os.Stdout),
+	}
+}
+
+// Execute lists the top-level packages brew installed outside of keg.yml and
+// adds them to it: all of them with all, otherwise the ones the user picks.
+func (a *Adopter) Execute(ctx context.Context, all bool, groups []string) error {
+	leaves, err := a.Unmanaged()
+	if err != nil {
+		return err
+	}
+	if len(leaves) == 0 {
+		logger.Success("Every top-level package is already in keg.yml")
+		return nil
+	}
+
+	if err := a.render(ctx, leaves); err != nil {
+		return err
+	}
+
+	selected := leaves
+	if !all {
+		if selected, err = a.pick(leaves); err != nil {
+			return err
+		}
+	}
+	if len(selected) == 0 {
+		logger.Info("Nothing adopted")
+		return nil
+	}
+
+	modified, err := manifest.AddPackages(a.Config, a.FindPackage, selected, "", false, groups)
+	if err != nil {
+		return err
+	}
+	if !modified {
+		return nil
+	}
+	if err := saveConfig(a.Config); err != nil {
+		return err
+	}
+	logger.Success("Added %d package(s) to keg.yml", len(selected))
+	return nil
+}
+
+// Unmanaged returns the brew leaves that keg.yml does not declare, sorted.
+// Leaves are installed formulae nothing else depends on, so this leaves out
+// the dependencies pulled in by other packages.
+func (a *Adopter) Unmanaged() ([]string, error) {
+	leaves, err := utils.LeavesSet(a.Runner)
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make(map[string]bool, len(a.Config.Packages))
+	for _, p := range a.Config.Packages {
+		managed[p.FormulaName()] = true
+	}
+
+	out := utils.Filter(utils.Keys(leaves), func(name string) bool {
+		return !managed[(&models.Package{Command: name}).FormulaName()]
+	})
+	sort.Strings(out)
+	return out, nil
+}
+
+func (a *Adopter) pick(leaves []string) ([]string, error) {
+	var out []string
+	for _, name := range leaves {
+		ok, err := a.Prompter.Confirm(fmt.Sprintf("Add %s to keg.yml?", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read user input: %w", err)
+		}
+		if ok {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+func (a *Adopter) render(ctx context.Context, leaves []string) error {
+	names := utils.Map(leaves, func(n string) string { return (&models.Package{Command: n}).FormulaName() })
+	info, err := versions.NewResolver(a.Runner).ResolveBulk(ctx, names)
+	if err != nil {
+		logger.Debug("version resolution failed (adopt): %v", err)
+		info = map[string]versions.Info{}
+	}
+
+	table := logger.CreateTable([]string{"Package", "Version"})
+	for i, name := range leaves {
+		ver := "—"
+		if vi, ok := info[names[i]]; ok && vi.Installed != "" {
+			ver = vi.Installed
+		}
+		if err := table.Append([]string{name, ver}); err != nil {
+			return fmt.Errorf("append to table: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("render table: %w", err)
+	}
+	return nil
+}
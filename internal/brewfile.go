@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/MrSnakeDoc/keg/internal/brewfile"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func NewImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import packages into keg.yml from another format",
+	}
+	cmd.AddCommand(middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.LoadPkgList)(newImportBrewfileCmd)())
+	return cmd
+}
+
+func NewExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export keg.yml to another format",
+	}
+	cmd.AddCommand(middleware.UseMiddlewareChain(middleware.LogToStderr, middleware.RequireConfig, middleware.LoadPkgList)(newExportBrewfileCmd)())
+	return cmd
+}
+
+func newImportBrewfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "brewfile <path>",
+		Short: "Add the taps and formulae of a Brewfile to keg.yml",
+		Long: `Add the taps and formulae of a Homebrew Bundle Brewfile to keg.yml.
+
+Only 'tap' and 'brew' entries are imported. Casks, Mac App Store apps and
+conditional entries are reported and skipped. keg.yml is edited in place.
+
+Examples:
+  keg import brewfile ~/Brewfile
+  keg import brewfile ./Brewfile --group cli`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: dryRunnable,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			groups, err := cmd.Flags().GetStringSlice("group")
+			if err != nil {
+				return err
+			}
+
+			return brewfile.New(cfg, nil).Import(args[0], groups)
+		},
+	}
+
+	cmd.Flags().StringSliceP("group", "g", nil, "Tag the imported packages with these groups")
+	return cmd
+}
+
+func newExportBrewfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "brewfile",
+		Short: "Write keg.yml as a Brewfile",
+		Long: `Write the taps and packages of keg.yml as a Homebrew Bundle Brewfile,
+for 'brew bundle' on machines without keg.
+
+Like 'keg install', only packages that apply to this host are exported, and
+optional ones only with --all.
+
+Examples:
+  keg export brewfile > Brewfile
+  keg export brewfile --all --output ~/Brewfile`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			all, err := cmd.Flags().GetBool("all")
+			if err != nil {
+				return err
+			}
+			output, err := cmd.Flags().GetString("output")
+			if err != nil {
+				return err
+			}
+
+			m := brewfile.New(cfg, nil)
+			if output == "" {
+				return m.Export(cmd.OutOrStdout(), all)
+			}
+
+			var buf bytes.Buffer
+			if err := m.Export(&buf, all); err != nil {
+				return err
+			}
+			if err := utils.WriteFileAtomic(output+".tmp", output, &buf); err != nil {
+				return fmt.Errorf("failed to write %s: %w", output, err)
+			}
+			logger.Success("Wrote %s", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolP("all", "a", false, "Export optional packages too")
+	cmd.Flags().StringP("output", "o", "", "Write the Brewfile to this path instead of stdout")
+	return cmd
+}
@@ -0,0 +1,290 @@
+package brewfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Formula is a `brew` entry of a Brewfile.
+type Formula struct {
+	Name string
+	Args []string
+}
+
+// Skipped is a Brewfile line keg has no equivalent for (casks, mas apps,
+// conditionals…).
+type Skipped struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+// File is the part of a Brewfile keg understands.
+type File struct {
+	Taps     []string
+	Formulae []Formula
+	Skipped  []Skipped
+	// Ignored lists, per formula, the options keg drops (restart_service, link…).
+	Ignored map[string][]string
+}
+
+// Read parses the Brewfile at path.
+func Read(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	bf, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bf, nil
+}
+
+// Parse reads the `tap` and `brew` entries of a Brewfile. A Brewfile is Ruby;
+// only the plain `directive "name", key: value` form is understood and
+// anything else is reported in Skipped.
+func Parse(r io.Reader) (*File, error) {
+	bf := &File{Ignored: make(map[string][]string)}
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimSpace(stripComment(sc.Text()))
+		if text == "" {
+			continue
+		}
+
+		directive, rest := text, ""
+		if i := strings.IndexAny(text, " \t"); i >= 0 {
+			directive, rest = text[:i], text[i+1:]
+		}
+		directive, rest = trimParens(directive, rest)
+		args, err := splitArgs(rest)
+		if err != nil {
+			bf.Skipped = append(bf.Skipped, Skipped{Line: n, Text: text, Reason: err.Error()})
+			continue
+		}
+
+		switch directive {
+		case "tap":
+			if len(args) == 0 || !isString(args[0]) {
+				bf.Skipped = append(bf.Skipped, Skipped{Line: n, Text: text, Reason: "tap without a name"})
+				continue
+			}
+			// A custom clone URL (second argument) is left to brew's defaults.
+			bf.Taps = append(bf.Taps, unquote(args[0]))
+		case "brew":
+			if len(args) == 0 || !isString(args[0]) {
+				bf.Skipped = append(bf.Skipped, Skipped{Line: n, Text: text, Reason: "brew without a name"})
+				continue
+			}
+			f, ignored, ok := parseFormula(args)
+			if !ok {
+				bf.Skipped = append(bf.Skipped, Skipped{Line: n, Text: text, Reason: "unsupported syntax"})
+				continue
+			}
+			if len(ignored) > 0 {
+				bf.Ignored[f.Name] = ignored
+			}
+			bf.Formulae = append(bf.Formulae, f)
+		default:
+			bf.Skipped = append(bf.Skipped, Skipped{Line: n, Text: text, Reason: fmt.Sprintf("%s entries are not supported", directive)})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+// parseFormula reads the name and options of a `brew` entry. It also returns
+// the option keys keg has no equivalent for.
+func parseFormula(args []string) (Formula, []string, bool) {
+	f := Formula{Name: unquote(args[0])}
+	var ignored []string
+	for _, opt := range args[1:] {
+		key, val, ok := strings.Cut(opt, ":")
+		switch {
+		case !ok:
+			return f, nil, false
+		case key == "args":
+			f.Args = parseList(val)
+		default:
+			ignored = append(ignored, key)
+		}
+	}
+	return f, ignored, true
+}
+
+// Write renders taps and formulae as a Brewfile.
+func Write(w io.Writer, taps []string, formulae []Formula) error {
+	var b strings.Builder
+	b.WriteString("# Generated by keg export brewfile\n")
+	if len(taps) > 0 {
+		b.WriteString("\n")
+	}
+	for _, t := range taps {
+		fmt.Fprintf(&b, "tap %s\n", rubyString(t))
+	}
+	if len(formulae) > 0 {
+		b.WriteString("\n")
+	}
+	for _, f := range formulae {
+		fmt.Fprintf(&b, "brew %s", rubyString(f.Name))
+		if len(f.Args) > 0 {
+			quoted := make([]string, 0, len(f.Args))
+			for _, a := range f.Args {
+				quoted = append(quoted, rubyString(a))
+			}
+			fmt.Fprintf(&b, ", args: [%s]", strings.Join(quoted, ", "))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// stripComment drops a trailing `# comment`, ignoring # inside strings.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// trimParens handles the `brew("name")` call form.
+func trimParens(directive, rest string) (string, string) {
+	if name, args, ok := strings.Cut(directive, "("); ok {
+		rest = strings.TrimSuffix(strings.TrimSpace(args+" "+rest), ")")
+		return name, rest
+	}
+	return directive, rest
+}
+
+// splitArgs splits the arguments of a directive on top-level commas.
+// Trailing Ruby modifiers (`if OS.mac?`) are refused: keg cannot evaluate them.
+func splitArgs(s string) ([]string, error) {
+	var (
+		out   []string
+		cur   strings.Builder
+		quote rune
+		depth int
+	)
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			out = append(out, strings.TrimSpace(cur.String()))
+			cur.Reset()
+			continue
+		}
+		cur.WriteRune(c)
+	}
+	if quote != 0 || depth != 0 {
+		return nil, errors.New("unbalanced quotes or brackets")
+	}
+	if last := strings.TrimSpace(cur.String()); last != "" {
+		out = append(out, last)
+	}
+	if err := checkArgs(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// checkArgs accepts string literals and `key: value` options only.
+func checkArgs(args []string) error {
+	for _, a := range args {
+		if hasModifier(a) {
+			return errors.New("conditional entries are not supported")
+		}
+		if !isString(a) && !strings.Contains(a, ":") {
+			return errors.New("unsupported syntax")
+		}
+	}
+	return nil
+}
+
+// hasModifier reports whether s carries a Ruby `if`/`unless` modifier
+// outside of string literals.
+func hasModifier(s string) bool {
+	var (
+		word  strings.Builder
+		quote rune
+	)
+	check := func() bool {
+		w := word.String()
+		word.Reset()
+		return w == "if" || w == "unless"
+	}
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ' ' || c == '\t':
+			if check() {
+				return true
+			}
+		default:
+			word.WriteRune(c)
+		}
+	}
+	return check()
+}
+
+func isString(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0]
+}
+
+func unquote(s string) string {
+	if isString(s) {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func rubyString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// parseList reads a Ruby array of strings: `["a", "b"]`. A lone string is
+// accepted as a one-item list.
+func parseList(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]")
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = unquote(strings.TrimSpace(item)); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package brewfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+const sample = `# Dev tools
+tap "hashicorp/tap"
+tap "owner/custom", "https://example.com/custom.git"
+
+brew "ripgrep" # search
+brew "hashicorp/tap/terraform"
+brew("jq")
+brew "vim", args: ["with-lua", "HEAD"]
+brew "postgresql@16", restart_service: true, link: false
+brew "gnu-sed" if OS.mac?
+cask "firefox"
+mas "Xcode", id: 497799835
+`
+
+func TestParse(t *testing.T) {
+	bf, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if want := []string{"hashicorp/tap", "owner/custom"}; !reflect.DeepEqual(bf.Taps, want) {
+		t.Fatalf("taps = %v, want %v", bf.Taps, want)
+	}
+
+	want := []Formula{
+		{Name: "ripgrep"},
+		{Name: "hashicorp/tap/terraform"},
+		{Name: "jq"},
+		{Name: "vim", Args: []string{"with-lua", "HEAD"}},
+		{Name: "postgresql@16"},
+	}
+	if !reflect.DeepEqual(bf.Formulae, want) {
+		t.Fatalf("formulae = %+v, want %+v", bf.Formulae, want)
+	}
+	if got := bf.Ignored["postgresql@16"]; !reflect.DeepEqual(got, []string{"restart_service", "link"}) {
+		t.Fatalf("ignored options = %v", got)
+	}
+
+	var lines []int
+	for _, s := range bf.Skipped {
+		lines = append(lines, s.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{10, 11, 12}) {
+		t.Fatalf("expected lines 10-12 to be skipped, got %+v", bf.Skipped)
+	}
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	taps := []string{"hashicorp/tap"}
+	formulae := []Formula{{Name: "ripgrep"}, {Name: "vim", Args: []string{"with-lua"}}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, taps, formulae); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	bf, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !reflect.DeepEqual(bf.Taps, taps) || !reflect.DeepEqual(bf.Formulae, formulae) || len(bf.Skipped) != 0 {
+		t.Fatalf("round trip mismatch: %+v", bf)
+	}
+}
+
+func TestImport(t *testing.T) {
+	var saved int
+	oldSave := saveConfig
+	saveConfig = func(_ *models.Config) error { saved++; return nil }
+	defer func() { saveConfig = oldSave }()
+
+	path := filepath.Join(t.TempDir(), "Brewfile")
+	if err := os.WriteFile(path, []byte(sample), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &models.Config{
+		Taps:     []string{"hashicorp/tap"},
+		Packages: []models.Package{{Command: "ripgrep", Binary: "rg"}},
+	}
+	m := New(cfg, runner.NewMockRunner())
+	if err := m.Import(path, []string{"imported"}); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	if want := []string{"hashicorp/tap", "owner/custom"}; !reflect.DeepEqual(cfg.Taps, want) {
+		t.Fatalf("taps = %v, want %v", cfg.Taps, want)
+	}
+	var got []string
+	for _, p := range cfg.Packages {
+		got = append(got, p.Command)
+	}
+	if want := []string{"ripgrep", "hashicorp/tap/terraform", "jq", "vim", "postgresql@16"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("packages = %v, want %v", got, want)
+	}
+	if vim := cfg.Packages[3]; strings.Join(vim.Args, " ") != "--with-lua --HEAD" {
+		t.Fatalf("expected Brewfile args to become flags, got %v", vim.Args)
+	}
+	if !cfg.Packages[0].InAnyGroup([]string{"imported"}) || saved != 1 {
+		t.Fatalf("expected existing packages to get the group and keg.yml to be saved once")
+	}
+
+	// Importing again changes nothing
+	if err := m.Import(path, []string{"imported"}); err != nil || saved != 1 {
+		t.Fatalf("second import must be a no-op, err=%v saved=%d", err, saved)
+	}
+}
+
+func TestExport(t *testing.T) {
+	cfg := &models.Config{
+		Taps: []string{"hashicorp/tap"},
+		Packages: []models.Package{
+			{Command: "ripgrep", Binary: "rg", Args: models.StringList{"--HEAD"}},
+			{Command: "kubectx", Tap: "owner/k8s"},
+			{Command: "jq", Args: models.StringList{"-s", "-x"}},
+			{Command: "lazygit", Optional: true},
+			{Command: "wslu", When: &models.When{Env: map[string]string{"WSL_DISTRO_NAME": ""}}},
+		},
+	}
+	m := New(cfg, runner.NewMockRunner())
+	m.Host = &models.Host{OS: "linux", LookupEnv: func(string) (string, bool) { return "", false }}
+
+	var buf bytes.Buffer
+	if err := m.Export(&buf, false); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	want := `# Generated by keg export brewfile
+
+tap "hashicorp/tap"
+tap "owner/k8s"
+
+brew "ripgrep", args: ["HEAD"]
+brew "owner/k8s/kubectx"
+brew "jq", args: ["build-from-source"]
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected Brewfile:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := m.Export(&buf, true); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if !strings.Contains(buf.String(), `brew "lazygit"`) {
+		t.Fatalf("--all must export optional packages:\n%s", buf.String())
+	}
+}
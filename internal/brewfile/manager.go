@@ -0,0 +1,175 @@
+package brewfile
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/MrSnakeDoc/keg/internal/core"
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/manifest"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+var saveConfig = globalconfig.SaveConfig
+
+type Manager struct {
+	*core.Base
+}
+
+func New(config *models.Config, r runner.CommandRunner) *Manager {
+	if r == nil {
+		r = runner.New()
+	}
+
+	return &Manager{
+		Base: core.NewBase(config, r),
+	}
+}
+
+// Import adds the taps and formulae of the Brewfile at path to keg.yml,
+// tagging new packages with groups.
+func (m *Manager) Import(path string, groups []string) error {
+	bf, err := Read(path)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range bf.Skipped {
+		logger.Warn("%s:%d: skipped %q: %s", path, s.Line, s.Text, s.Reason)
+	}
+
+	names := make([]string, 0, len(bf.Formulae))
+	for _, f := range bf.Formulae {
+		if opts := bf.Ignored[f.Name]; len(opts) > 0 {
+			logger.Warn("%s: ignored %s", f.Name, strings.Join(opts, ", "))
+		}
+		names = append(names, f.Name)
+	}
+
+	taps, err := manifest.AddTaps(m.Config, bf.Taps)
+	if err != nil {
+		return err
+	}
+	modified := len(taps) > 0
+	if len(names) > 0 {
+		added, err := manifest.AddPackages(m.Config, m.FindPackage, names, "", false, groups)
+		if err != nil {
+			return err
+		}
+		modified = modified || added
+	}
+
+	// Brewfile args become install flags, unless keg.yml already sets some
+	for _, f := range bf.Formulae {
+		if len(f.Args) == 0 {
+			continue
+		}
+		args := flags(f.Args)
+		updated, err := manifest.UpdatePackage(m.Config, m.FindPackage, f.Name, func(p *models.Package) bool {
+			if len(p.Args) > 0 {
+				return false
+			}
+			p.Args = args
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		modified = modified || updated
+	}
+
+	if !modified {
+		logger.Info("keg.yml already has everything from %s", path)
+		return nil
+	}
+	if err := saveConfig(m.Config); err != nil {
+		return err
+	}
+	logger.Success("Imported %s into keg.yml", path)
+	return nil
+}
+
+// Export writes keg.yml as a Brewfile, so `brew bundle` can set up the same
+// packages where keg is not available. Like `keg install`, it only keeps the
+// packages that apply to this host, and optional ones only with all.
+// Brewfiles have no per-formula environment, so env is left out.
+func (m *Manager) Export(w io.Writer, all bool) error {
+	seen := make(map[string]bool)
+	var taps []string
+	addTap := func(t string) {
+		if key := utils.NormalizeTap(t); key != "" && !seen[key] {
+			seen[key] = true
+			taps = append(taps, t)
+		}
+	}
+	for _, t := range m.Config.AllTaps() {
+		addTap(t)
+	}
+
+	var formulae []Formula
+	for i := range m.Config.Packages {
+		p := &m.Config.Packages[i]
+		if (p.Optional && !all) || !p.AvailableOn(m.Host) {
+			continue
+		}
+		if t := p.TapName(); t != "" {
+			addTap(t)
+		}
+		formulae = append(formulae, Formula{Name: p.FullName(), Args: bundleArgs(p.Command, p.Args)})
+	}
+
+	if err := Write(w, taps, formulae); err != nil {
+		return fmt.Errorf("failed to write Brewfile: %w", err)
+	}
+	return nil
+}
+
+// flags turns Brewfile args, written without dashes (`args: ["HEAD"]`),
+// into brew flags.
+func flags(args []string) models.StringList {
+	out := make(models.StringList, 0, len(args))
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			a = "--" + a
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// longFlags maps the short `brew install` flags to the long form brew
+// bundle needs: it puts `--` in front of every Brewfile arg.
+var longFlags = map[string]string{
+	"-d": "--debug",
+	"-f": "--force",
+	"-g": "--git",
+	"-i": "--interactive",
+	"-q": "--quiet",
+	"-s": "--build-from-source",
+	"-v": "--verbose",
+}
+
+// bundleArgs is the reverse of flags. Short flags are written in their long
+// form; the ones without a known long form are left out with a warning.
+func bundleArgs(name string, args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(args))
+	for _, a := range args {
+		if !strings.HasPrefix(a, "--") {
+			long, ok := longFlags[a]
+			if !ok {
+				logger.Warn("%s: %s has no Brewfile equivalent, left out", name, a)
+				continue
+			}
+			a = long
+		}
+		out = append(out, strings.TrimPrefix(a, "--"))
+	}
+	return out
+}
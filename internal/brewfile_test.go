@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+// redirect points f (os.Stdout, os.Stderr) at a temporary file until the
+// test ends and returns a function reading what was written to it.
+func redirect(t *testing.T, f **os.File) func() string {
+	t.Helper()
+	tmp, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	orig := *f
+	*f = tmp
+	t.Cleanup(func() {
+		*f = orig
+		_ = tmp.Close()
+	})
+	return func() string {
+		data, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return string(data)
+	}
+}
+
+func TestExportBrewfile_KeepsLogsOutOfStdout(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("KEG_NO_UPDATE_CHECK", "1")
+	manifest := filepath.Join(home, "keg.yml")
+	// -x has no Brewfile equivalent: exporting it logs a warning
+	if err := os.WriteFile(manifest, []byte("packages:\n  - command: jq\n    args: [\"-x\"]\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Cleanup(func() {
+		globalconfig.FlagManifest = ""
+		logger.UseTestMode()
+	})
+
+	stdout := redirect(t, &os.Stdout)
+	stderr := redirect(t, &os.Stderr)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"export", "brewfile", "--manifest", manifest})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	out := stdout()
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "brew ") && !strings.HasPrefix(line, "tap ") {
+			t.Errorf("stdout has a non-Brewfile line %q:\n%s", line, out)
+		}
+	}
+	if !strings.Contains(out, `brew "jq"`) {
+		t.Fatalf("expected the Brewfile on stdout, got:\n%s", out)
+	}
+	if !strings.Contains(stderr(), "-x has no Brewfile equivalent") {
+		t.Fatalf("expected the warning on stderr, got:\n%s", stderr())
+	}
+}
@@ -8,12 +8,23 @@ import (
 var defaultCommands = []middleware.CommandFactory{
 	NewInitCmd,
 	NewBootstrapCmd,
+	NewProfileCmd,
 	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.LoadPkgList)(NewDeployCmd),
 	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.LoadPkgList)(NewListCmd),
 	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(NewInstallCmd),
 	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(NewUpgradeCmd),
+	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(NewPlanCmd),
+	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(NewSyncCmd),
 	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(NewDeleteCmd),
+	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(NewLockCmd),
+	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(NewAdoptCmd),
+	NewLinksCmd,
+	middleware.UseMiddlewareChain(middleware.LogToStderr, middleware.RequireConfig, middleware.LoadCachedPkgList)(NewShellenvCmd),
+	NewImportCmd,
+	NewExportCmd,
 	NewUpdateCmd,
+	NewValidateCmd,
+	NewDoctorCmd,
 	middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.LoadPkgList)(NewSearchCmd),
 }
 
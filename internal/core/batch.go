@@ -0,0 +1,83 @@
+package core
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+// maxBatchSize caps the formulae of one brew call, as versions.Resolver
+// does for `brew info`.
+const maxBatchSize = 50
+
+// batchable lists the actions brew accepts several formulae for.
+var batchable = map[string]bool{"install": true, "uninstall": true}
+
+// runBatches installs or uninstalls, with one brew call per chunk of
+// maxBatchSize, the packages the per-package loop of HandlePackages would
+// hand to brew as they are: no flags, environment nor hooks. Each brew call
+// costs its start-up and auto-update check, which dominate a fresh deploy.
+//
+// The packages of a chunk that succeeded are marked in b.batched, so that
+// runAction does not call brew again for them; everything else the loop does
+// (caches, pins, links, logs) is unchanged. They are journaled right away,
+// and the marks the loop did not get to, because it stopped at a failure,
+// are dropped by HandlePackages. When a chunk fails, nothing is marked and
+// the loop calls brew for each package, which tells which one failed; the
+// packages the chunk did get to are no-ops for brew by then.
+func (b *Base) runBatches(opts PackageHandlerOptions, names []string) {
+	action := opts.Action.ActionVerb
+	if !batchable[action] || runner.IsDryRun(b.Runner) {
+		return
+	}
+	var batch []string
+	for _, name := range names {
+		if pkg := b.batchablePackage(action, name, opts); pkg != nil {
+			batch = append(batch, pkg.FullName())
+		}
+	}
+	if len(batch) < 2 {
+		return
+	}
+
+	if b.batched == nil {
+		b.batched = make(map[string]bool)
+	}
+	for i := 0; i < len(batch); i += maxBatchSize {
+		chunk := batch[i:min(i+maxBatchSize, len(batch))]
+		logger.Info("Running brew %s on %d packages...", action, len(chunk))
+		if err := utils.RunBrewCommandMany(b.Runner, action, chunk, nil, nil, toleratedWarnings); err != nil {
+			logger.Warn("brew %s of %d packages failed, retrying them one at a time", action, len(chunk))
+			logger.Debug("batched brew %s failed: %v", action, err)
+			continue
+		}
+		for _, full := range chunk {
+			b.batched[(&models.Package{Command: full}).FormulaName()] = true
+			// Journaled now: the loop may stop before it gets to them
+			if action == "install" {
+				b.journal.recordInstall(full)
+			}
+		}
+	}
+}
+
+// batchablePackage returns the package name stands for when the loop would
+// run `brew <action> <name>` with nothing else around it.
+func (b *Base) batchablePackage(action, name string, opts PackageHandlerOptions) *models.Package {
+	pkg, err := b.resolvePackageScoped(name, opts.AllowAdHoc)
+	if err != nil || !pkg.AvailableOn(b.Host) || !opts.ValidateFunc(pkg.FormulaName()) {
+		return nil
+	}
+	if args, env := brewArgs(pkg, action); len(args) > 0 || len(env) > 0 || b.hasHooks(pkg, action) {
+		return nil
+	}
+	if installed := b.IsPackageInstalled(pkg.FormulaName()); installed != (action == "uninstall") {
+		return nil
+	}
+	// runAction taps before installing; a failing tap is left for it to report
+	if tap := pkg.TapName(); tap != "" && action == "install" && b.ensureTaps(tap) != nil {
+		return nil
+	}
+	return pkg
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/MrSnakeDoc/keg/internal/brew"
+	"github.com/MrSnakeDoc/keg/internal/links"
 	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/MrSnakeDoc/keg/internal/models"
 	"github.com/MrSnakeDoc/keg/internal/runner"
@@ -13,7 +15,13 @@ import (
 	"github.com/MrSnakeDoc/keg/internal/versions"
 )
 
-var ErrPkgNotFound = errors.New("package not found in configuration")
+var (
+	ErrPkgNotFound  = errors.New("package not found in configuration")
+	ErrUnknownGroup = errors.New("no package in configuration belongs to group")
+)
+
+// toleratedWarnings are brew failures that leave the package usable.
+var toleratedWarnings = []string{"Warning: The post-install step did not complete successfully"}
 
 var pastTense = map[string]string{
 	"install":   "installed",
@@ -26,7 +34,7 @@ var pastTense = map[string]string{
 // Implementations of this interface must be able to:
 //   - Check if a package is already installed
 //   - Locate a package based on a provided name
-//   - Retrieve the display name for a package (binary or command)
+//   - Retrieve the formula name brew knows a package by
 type Controller interface {
 	IsPackageInstalled(name string) bool
 	FindPackage(name string) *models.Package
@@ -53,15 +61,29 @@ type PackageAction struct {
 // Fields:
 //   - Config: The user configuration containing package definitions
 //   - installedPkgs: A cache of installed packages to avoid repeated checks
+//   - tappedSet: A cache of taps already known to brew
 //   - Runner: A CommandRunner instance to execute system commands
+//   - Host: The machine packages' `when:` blocks are matched against
+//   - Links: Places the dotfiles of installed packages
+//   - journal: What the run changed, for Rollback
+//   - batched: Packages a batched brew call already acted on (see runBatches)
+//   - Jobs: How many packages are downloaded at once (see prefetch)
+//   - KeepGoing: Whether HandlePackages carries on after a failed package
 //
 // It stores the user configuration, the internal cache of installed packages,
 // and uses a CommandRunner to interact with the underlying system.
 type Base struct {
 	Config        *models.Config
 	installedPkgs map[string]bool
+	tappedSet     map[string]bool
 	Runner        runner.CommandRunner
+	Host          *models.Host
+	Links         *links.Linker
 	upgradedPkgs  []string
+	journal       Journal
+	batched       map[string]bool
+	Jobs          int
+	KeepGoing     bool
 }
 
 // BrewSessionState holds a snapshot of brew's view of the world for a
@@ -101,13 +123,18 @@ func NewBase(config *models.Config, r runner.CommandRunner) *Base {
 		Config:        config,
 		installedPkgs: make(map[string]bool),
 		Runner:        r,
+		Host:          utils.CurrentHost(),
+		Links:         links.NewLinker(config),
+		Jobs:          max(FlagJobs, 1),
+		KeepGoing:     FlagKeepGoing,
 	}
 }
 
 // FindPackage attempts to locate a package from the configuration based on its name.
 //
 // Parameters:
-//   - name: the name to search for (matches .Command or .Binary fields)
+//   - name: the name to search for (matches .Command, .Binary, the short
+//     formula name or the fully qualified owner/tap/formula name)
 //
 // Returns:
 //   - *models.Package: pointer to the matched package
@@ -118,6 +145,9 @@ func (b *Base) FindPackage(name string) (*models.Package, bool) {
 		if pkg.Command == name || (pkg.Binary != "" && pkg.Binary == name) {
 			return pkg, true
 		}
+		if pkg.FormulaName() == name || pkg.FullName() == name {
+			return pkg, true
+		}
 	}
 	return nil, false
 }
@@ -155,18 +185,72 @@ func (b *Base) loadInstalledPackages() error {
 	return nil
 }
 
-// GetPackageName returns the most appropriate name to use for a package.
+// GetPackageName returns the formula name brew knows the package by.
 //
 // Parameters:
 //   - pkg: the package whose name is to be retrieved
 //
 // Returns:
-//   - string: pkg.Binary if available, otherwise pkg.Command
+//   - string: the short formula name (pkg.Command without any owner/tap/ prefix)
+//
+// Notes:
+//   - pkg.Binary is never used here: it names the executable the formula
+//     provides, which is only checked after install (see verifyBinary).
 func (*Base) GetPackageName(pkg *models.Package) string {
-	if pkg.Binary != "" {
-		return pkg.Binary
+	return pkg.FormulaName()
+}
+
+// verifyBinary warns when a package declares a binary that cannot be found
+// on PATH or in the brew prefix once the formula is installed.
+func (*Base) verifyBinary(pkg *models.Package) {
+	if pkg.Binary == "" {
+		return
+	}
+	if path, ok := utils.ResolveBinary(pkg.Binary); ok {
+		logger.Debug("binary %s for %s resolved to %s", pkg.Binary, pkg.Command, path)
+		return
+	}
+	logger.Warn("%s is installed but binary %s was not found on PATH or in %s/bin",
+		pkg.Command, pkg.Binary, utils.HomebrewPrefix())
+}
+
+// ensureTaps runs `brew tap` for every given tap brew does not know yet.
+//
+// Parameters:
+//   - taps: tap names (owner/repo); empty entries are ignored
+//
+// Returns:
+//   - error: if the tap list cannot be read or a `brew tap` call fails
+//
+// Notes:
+//   - The list of existing taps is loaded lazily once per Base.
+func (b *Base) ensureTaps(taps ...string) error {
+	for _, tap := range taps {
+		tap = strings.TrimSpace(tap)
+		if tap == "" {
+			continue
+		}
+
+		if b.tappedSet == nil {
+			set, err := utils.TappedSet(b.Runner)
+			if err != nil {
+				return err
+			}
+			b.tappedSet = set
+		}
+
+		key := utils.NormalizeTap(tap)
+		if b.tappedSet[key] {
+			continue
+		}
+
+		logger.Info("Tapping %s...", tap)
+		if err := utils.RunBrewCommand(b.Runner, "tap", tap, nil, nil, nil); err != nil {
+			return err
+		}
+		b.tappedSet[key] = true
 	}
-	return pkg.Command
+	return nil
 }
 
 // DefaultPackageHandlerOptions returns a default configuration for handling packages.
@@ -189,6 +273,43 @@ func DefaultPackageHandlerOptions(action PackageAction) PackageHandlerOptions {
 	}
 }
 
+// GroupFilter builds a FilterFunc that keeps packages belonging to at least
+// one of the given groups, optional or not.
+//
+// Parameters:
+//   - groups: group names as given with --group (case-insensitive)
+//
+// Returns:
+//   - func(*models.Package) bool: filter suitable for PackageHandlerOptions.FilterFunc
+func GroupFilter(groups []string) func(*models.Package) bool {
+	return func(p *models.Package) bool { return p.InAnyGroup(groups) }
+}
+
+// ValidateGroups ensures every requested group matches at least one package,
+// so a typo in --group fails loudly instead of silently doing nothing.
+//
+// Parameters:
+//   - cfg: the loaded manifest
+//   - groups: group names as given with --group
+//
+// Returns:
+//   - error: wrapping ErrUnknownGroup for the first group without members
+func ValidateGroups(cfg *models.Config, groups []string) error {
+	for _, g := range groups {
+		found := false
+		for i := range cfg.Packages {
+			if cfg.Packages[i].InAnyGroup([]string{g}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", ErrUnknownGroup, g)
+		}
+	}
+	return nil
+}
+
 // loadSessionState initializes a BrewSessionState for operations that need a
 // global view of installed/outdated packages (typically upgrades).
 func (b *Base) loadSessionState() (*BrewSessionState, error) {
@@ -210,6 +331,7 @@ func (b *Base) loadSessionState() (*BrewSessionState, error) {
 // Behavior:
 //   - If opts.Packages is non-empty, only those packages are handled
 //   - Otherwise, all packages passing FilterFunc are considered
+//   - With KeepGoing, every package is handled and the errors are joined
 func (b *Base) HandlePackages(opts PackageHandlerOptions) error {
 	// Ensure finalizeUpgrades always runs for upgrades, even on early returns
 	if opts.Action.ActionVerb == "upgrade" {
@@ -233,25 +355,56 @@ func (b *Base) HandlePackages(opts PackageHandlerOptions) error {
 		opts.ValidateFunc = func(string) bool { return true }
 	}
 
-	if len(opts.Packages) > 0 {
-		for _, pkgName := range opts.Packages {
-			if err := b.handleSelectedPackageWithSession(opts.Action, pkgName, opts.ValidateFunc, opts.AllowAdHoc, session); err != nil {
-				return fmt.Errorf("failed to %s package %s: %w", opts.Action.ActionVerb, pkgName, err)
+	if opts.Action.ActionVerb == "install" {
+		if err := b.ensureTaps(b.Config.AllTaps()...); err != nil {
+			return fmt.Errorf("failed to tap repositories: %w", err)
+		}
+	}
+
+	names := opts.Packages
+	if len(names) == 0 {
+		for i := range b.Config.Packages {
+			if pkg := &b.Config.Packages[i]; opts.FilterFunc(pkg) {
+				names = append(names, b.GetPackageName(pkg))
 			}
 		}
-		return nil
 	}
 
-	for _, pkg := range b.Config.Packages {
-		if !opts.FilterFunc(&pkg) {
-			continue
+	b.prefetch(opts.Action.ActionVerb, names, opts.AllowAdHoc, session)
+	b.runBatches(opts, names)
+	defer clear(b.batched)
+
+	return b.handleAll(opts, names, session)
+}
+
+// SelectPackages returns the manifest packages HandlePackages would act on
+// for opts, leaving out the ones not available on this host.
+//
+// Returns:
+//   - error: wrapping ErrPkgNotFound when a named package is not in the manifest
+func (b *Base) SelectPackages(opts PackageHandlerOptions) ([]*models.Package, error) {
+	var out []*models.Package
+
+	if len(opts.Packages) > 0 {
+		for _, name := range opts.Packages {
+			pkg, ok := b.FindPackage(name)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPkgNotFound, name)
+			}
+			if pkg.AvailableOn(b.Host) {
+				out = append(out, pkg)
+			}
 		}
-		name := b.GetPackageName(&pkg)
-		if err := b.handleSelectedPackageWithSession(opts.Action, name, opts.ValidateFunc, opts.AllowAdHoc, session); err != nil {
-			return fmt.Errorf("failed to %s package %s: %w", opts.Action.ActionVerb, name, err)
+		return out, nil
+	}
+
+	for i := range b.Config.Packages {
+		pkg := &b.Config.Packages[i]
+		if (opts.FilterFunc == nil || opts.FilterFunc(pkg)) && pkg.AvailableOn(b.Host) {
+			out = append(out, pkg)
 		}
 	}
-	return nil
+	return out, nil
 }
 
 func (b *Base) finalizeUpgrades() {
@@ -337,13 +490,32 @@ func (b *Base) resolvePackageScoped(name string, allowAdHoc bool) (*models.Packa
 	return nil, fmt.Errorf("%w: %s", ErrPkgNotFound, name)
 }
 
-// guardUninstall aborts if we try to uninstall something not present.
-func (b *Base) guardUninstall(isInstalled bool, name string, verb string) error {
+// guardUninstall skips the uninstall of a package that is not installed,
+// before its pre_uninstall hook gets to run.
+func (b *Base) guardUninstall(isInstalled bool, name string, verb string) bool {
 	if verb == "uninstall" && !isInstalled {
 		logger.Info("Skipping %s: package not installed", name)
-		return nil
+		return false
 	}
-	return nil
+	return true
+}
+
+// guardHost skips packages whose `when:` block does not match this host.
+func (b *Base) guardHost(pkg *models.Package, displayName string) bool {
+	if pkg.AvailableOn(b.Host) {
+		return true
+	}
+	logger.Info("Skipping %s: n/a on this host", displayName)
+	return false
+}
+
+// guardPinned skips upgrades of packages pinned in the manifest.
+func (b *Base) guardPinned(pkg *models.Package, displayName string) bool {
+	if !pkg.IsPinned() {
+		return true
+	}
+	logger.Info("Skipping %s: pinned in keg.yml", displayName)
+	return false
 }
 
 // guardUpgrade decides whether an upgrade should run.
@@ -376,6 +548,7 @@ func (b *Base) guardUpgrade(session *BrewSessionState, isInstalled bool, display
 //   - error: if the operation fails at any step
 //
 // Behavior:
+//   - Skips packages not available on this host (see models.When)
 //   - Validates presence and installation state
 //   - Skips upgrade if not outdated
 //   - Skips package if already installed and SkipMessage is provided
@@ -386,7 +559,8 @@ func (b *Base) handleSelectedPackage(
 	isValid func(string) bool,
 	allowAdHoc bool,
 ) error {
-	return b.handleSelectedPackageWithSession(action, humanName, isValid, allowAdHoc, nil)
+	_, err := b.handleSelectedPackageWithSession(action, humanName, isValid, allowAdHoc, nil)
+	return err
 }
 
 // handleSelectedPackageWithSession is the internal implementation that optionally
@@ -397,73 +571,189 @@ func (b *Base) handleSelectedPackageWithSession(
 	isValid func(string) bool,
 	allowAdHoc bool,
 	session *BrewSessionState,
-) error {
+) (Outcome, error) {
 	// 1. Resolve & canonicalise
 	pkg, err := b.resolvePackageScoped(humanName, allowAdHoc)
 	if err != nil {
-		return err
+		return OutcomeFailed, err
+	}
+
+	// 2. Pre-flight guards
+	if !b.guardHost(pkg, humanName) {
+		return OutcomeSkipped, nil
 	}
 
 	execName := b.GetPackageName(pkg)
 	installed := b.IsPackageInstalled(execName)
 
-	// 2. Pre-flight guards
-	if err := b.guardUninstall(installed, humanName, action.ActionVerb); err != nil {
-		return err
+	if !b.guardUninstall(installed, humanName, action.ActionVerb) {
+		return OutcomeSkipped, nil
 	}
 
 	if action.ActionVerb == "upgrade" {
+		if !b.guardPinned(pkg, humanName) {
+			return OutcomeSkipped, nil
+		}
 		if !b.guardUpgrade(session, installed, humanName, execName) {
-			return nil
+			return OutcomeSkipped, nil
 		}
 	}
 
 	if !isValid(execName) {
 		logger.Info("Skipping %s: validation failed", humanName)
-		return nil
+		return OutcomeSkipped, nil
 	}
 
 	if installed && action.SkipMessage != "" {
 		logger.Success(action.SkipMessage, execName)
+		if action.ActionVerb == "install" {
+			b.applyPin(pkg, execName)
+			b.applyLinks(pkg)
+		}
+		return OutcomeSkipped, nil
+	}
+
+	// 3. Actual command, between its hooks
+	stages := hookStages[action.ActionVerb]
+	if err := b.runHooks(pkg, action.ActionVerb, stages[0]); err != nil {
+		logger.Warn("Skipping %s: %v", humanName, err)
+		return OutcomeSkipped, nil
+	}
+
+	if err := b.runAction(pkg, action.ActionVerb, humanName); err != nil {
+		return OutcomeFailed, err
+	}
+	b.recordAction(pkg, action.ActionVerb, execName)
+
+	if runner.IsDryRun(b.Runner) {
+		logger.Info("%s would be %s", humanName, pastTense[action.ActionVerb])
+	} else {
+		logger.Success("%s has been %s successfully!",
+			humanName, pastTense[action.ActionVerb])
+	}
+
+	// The package itself is done: a failing post hook is only reported
+	if err := b.runHooks(pkg, action.ActionVerb, stages[1]); err != nil {
+		logger.Warn("%s: %v", humanName, err)
+	}
+	return OutcomeOK, nil
+}
+
+// runAction taps what pkg needs and runs `brew <action>` on it.
+func (b *Base) runAction(pkg *models.Package, action, humanName string) error {
+	if b.batched[pkg.FormulaName()] {
+		delete(b.batched, pkg.FormulaName())
 		return nil
 	}
+	if tap := pkg.TapName(); tap != "" && action == "install" {
+		if err := b.ensureTaps(tap); err != nil {
+			return fmt.Errorf("error during %s of %s: %w", action, humanName, err)
+		}
+	}
 
-	// 3. Actual command
+	args, env := brewArgs(pkg, action)
 	if err := utils.RunBrewCommand(
 		b.Runner,
-		action.ActionVerb,
-		execName,
-		[]string{"Warning: The post-install step did not complete successfully"},
+		action,
+		pkg.FullName(),
+		args,
+		env,
+		toleratedWarnings,
 	); err != nil {
 		return fmt.Errorf("error during %s of %s: %w",
-			action.ActionVerb, humanName, err)
+			action, humanName, err)
 	}
+	return nil
+}
 
-	// Post-run bookkeeping per action
-	switch action.ActionVerb {
+// recordAction keeps the caches in line with what brew just did. In a
+// dry run brew did nothing: only the session's view of the machine moves on,
+// and pins and links go to the plan through the runner and the linker.
+func (b *Base) recordAction(pkg *models.Package, action, execName string) {
+	dry := runner.IsDryRun(b.Runner)
+	switch action {
 	case "upgrade":
 		// bulk finalize will do: cleanup -> refresh outdated -> bulk touch per pkg
-		b.upgradedPkgs = append(b.upgradedPkgs, execName)
+		if !dry {
+			b.upgradedPkgs = append(b.upgradedPkgs, execName)
+		}
 
 	case "install":
 		// immediately reflect reality so 'check' affiche la vraie version
 		if b.installedPkgs != nil {
 			b.installedPkgs[execName] = true
 		}
-		b.touchVersionCache(execName) // force resolver to record the installed version
+		if !dry {
+			b.journal.recordInstall(pkg.FullName())
+			b.touchVersionCache(execName) // force resolver to record the installed version
+			b.verifyBinary(pkg)
+		}
+		b.applyPin(pkg, execName)
+		b.applyLinks(pkg)
 
 	case "uninstall":
 		// keep internal cache coherent + drop version cache
 		delete(b.installedPkgs, execName)
-		err = versions.NewResolver(b.Runner).Remove(execName)
-		if err != nil {
+		if dry {
+			return
+		}
+		if err := versions.NewResolver(b.Runner).Remove(execName); err != nil {
 			logger.Debug("versions.Remove failed for %s: %v", execName, err)
 		}
 	}
+}
 
-	logger.Success("%s has been %s successfully!",
-		humanName, pastTense[action.ActionVerb])
-	return nil
+// applyLinks puts the dotfiles of pkg in place. Like applyPin it runs on
+// every install, so links added to keg.yml later are picked up; files already
+// at a target are never replaced here (see `keg links apply --force`).
+func (b *Base) applyLinks(pkg *models.Package) {
+	if len(pkg.Links) == 0 || b.Links == nil {
+		return
+	}
+	b.Links.Apply(pkg.FormulaName(), pkg.Links, false)
+}
+
+// brewArgs returns the extra flags and environment the manifest declares
+// for pkg, as they apply to action.
+func brewArgs(pkg *models.Package, action string) (args, env []string) {
+	switch action {
+	case "install":
+		return pkg.Args, pkg.Environ()
+	case "upgrade":
+		return pkg.UpgradeArgs(), pkg.Environ()
+	default:
+		return nil, nil
+	}
+}
+
+// applyPin runs `brew pin` for packages pinned in the manifest and warns
+// when the installed version does not match a declared `version:`.
+//
+// Notes:
+//   - `brew pin` is idempotent, so this is safe to call on every install run.
+//   - Failures are reported as warnings: the package itself is installed.
+func (b *Base) applyPin(pkg *models.Package, execName string) {
+	if !pkg.IsPinned() {
+		return
+	}
+
+	if err := utils.RunBrewCommand(b.Runner, "pin", pkg.FullName(), nil, nil, nil); err != nil {
+		logger.Warn("Failed to pin %s: %v", execName, err)
+		return
+	}
+	logger.Debug("%s pinned", execName)
+
+	if pkg.Version == "" {
+		return
+	}
+	info, err := versions.NewResolver(b.Runner).ResolveBulk(context.Background(), []string{execName})
+	if err != nil {
+		logger.Debug("versions.ResolveBulk failed for %s: %v", execName, err)
+		return
+	}
+	if got := info[execName].Installed; got != "" && !utils.MatchesVersion(got, pkg.Version) {
+		logger.Warn("%s is pinned to %s but %s is installed", execName, pkg.Version, got)
+	}
 }
 
 // touchVersionCache updates the versions cache for the given executable.
@@ -2,13 +2,18 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/prompter"
 	"github.com/MrSnakeDoc/keg/internal/runner"
 	"github.com/MrSnakeDoc/keg/internal/utils"
 	"github.com/MrSnakeDoc/keg/internal/versions"
@@ -114,8 +119,28 @@ func TestGetPackageName(t *testing.T) {
 	if got := b.GetPackageName(&models.Package{Command: "foo"}); got != "foo" {
 		t.Fatalf("want foo, got %s", got)
 	}
-	if got := b.GetPackageName(&models.Package{Command: "bar", Binary: "bbar"}); got != "bbar" {
-		t.Fatalf("want bbar, got %s", got)
+	if got := b.GetPackageName(&models.Package{Command: "bar", Binary: "bbar"}); got != "bar" {
+		t.Fatalf("want bar (formula name, not binary), got %s", got)
+	}
+}
+
+func TestFindPackage_FullyQualifiedNames(t *testing.T) {
+	cfg := &models.Config{
+		Packages: []models.Package{
+			{Command: "owner/tools/foo"},
+			{Command: "bar", Tap: "owner/tools"},
+		},
+	}
+	b := NewBase(cfg, runner.NewMockRunner())
+
+	if p, ok := b.FindPackage("foo"); !ok || p.Command != "owner/tools/foo" {
+		t.Fatalf("expected to find owner/tools/foo by short name")
+	}
+	if p, ok := b.FindPackage("owner/tools/bar"); !ok || p.Command != "bar" {
+		t.Fatalf("expected to find bar by fully qualified name")
+	}
+	if got := b.GetPackageName(&cfg.Packages[0]); got != "foo" {
+		t.Fatalf("want foo, got %s", got)
 	}
 }
 
@@ -209,6 +234,122 @@ func TestHandlePackages_WithArgs_Install(t *testing.T) {
 	}
 }
 
+func TestHandlePackages_Install_UsesFormulaNotBinary(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	cfg := &models.Config{Packages: []models.Package{{Command: "ripgrep", Binary: "rg"}}}
+	b := NewBase(cfg, mr)
+
+	opts := PackageHandlerOptions{
+		Action:   PackageAction{ActionVerb: "install"},
+		Packages: []string{"rg"},
+	}
+
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !mr.VerifyCommand("brew", "install", "ripgrep") {
+		t.Fatalf("expected brew install ripgrep, got %+v", mr.Commands)
+	}
+	if mr.VerifyCommand("brew", "install", "rg") {
+		t.Fatalf("binary name must not be passed to brew, got %+v", mr.Commands)
+	}
+}
+
+func TestHandlePackages_Install_PassesArgsAndEnv(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	cfg := &models.Config{Packages: []models.Package{{
+		Command: "neovim",
+		Args:    models.StringList{"--HEAD"},
+		Env:     map[string]string{"HOMEBREW_NO_INSTALL_CLEANUP": "1", "HOMEBREW_CURL_RETRIES": "5"},
+	}}}
+	b := NewBase(cfg, mr)
+
+	opts := PackageHandlerOptions{
+		Action:   PackageAction{ActionVerb: "install"},
+		Packages: []string{"neovim"},
+	}
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, c := range mr.Commands {
+		if c.Name == "brew" && len(c.Args) > 0 && c.Args[0] == "install" {
+			if strings.Join(c.Args, " ") != "install --HEAD neovim" {
+				t.Fatalf("unexpected install command: %v", c.Args)
+			}
+			if strings.Join(c.Env, " ") != "HOMEBREW_CURL_RETRIES=5 HOMEBREW_NO_INSTALL_CLEANUP=1" {
+				t.Fatalf("unexpected env: %v", c.Env)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected brew install, got %+v", mr.Commands)
+}
+
+func TestHandlePackages_Install_PinsPackage(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr, "bar")
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "foo", Pin: true},
+		{Command: "bar", Version: "1.5"},
+		{Command: "baz"},
+	}}
+	b := NewBase(cfg, mr)
+
+	opts := DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install", SkipMessage: "%s is already installed"})
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !mr.VerifyCommand("brew", "pin", "foo") {
+		t.Fatalf("expected brew pin foo after install, got %+v", mr.Commands)
+	}
+	if !mr.VerifyCommand("brew", "pin", "bar") {
+		t.Fatalf("expected brew pin bar for an already installed package, got %+v", mr.Commands)
+	}
+	if mr.VerifyCommand("brew", "pin", "baz") {
+		t.Fatalf("did not expect brew pin baz, got %+v", mr.Commands)
+	}
+}
+
+func TestHandlePackages_Install_SkipsOtherHosts(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr)
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "arm-only", When: &models.When{Arch: models.StringList{"aarch64"}}},
+		{Command: "ubuntu-only", When: &models.When{Distro: models.StringList{"debian"}}},
+		{Command: "build-box", When: &models.When{Hostname: models.StringList{"build-*"}}},
+		{Command: "wsl-only", When: &models.When{Env: map[string]string{"WSL_DISTRO_NAME": ""}}},
+	}}
+	b := NewBase(cfg, mr)
+	b.Host = &models.Host{
+		OS:         "linux",
+		Arch:       "amd64",
+		Hostname:   "laptop",
+		Distro:     "ubuntu",
+		DistroLike: []string{"debian"},
+		LookupEnv:  func(string) (string, bool) { return "", false },
+	}
+
+	opts := DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"})
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if !mr.VerifyCommand("brew", "install", "ubuntu-only") {
+		t.Fatalf("expected ubuntu-only to install on an ubuntu host, got %+v", mr.Commands)
+	}
+	for _, name := range []string{"arm-only", "build-box", "wsl-only"} {
+		if mr.VerifyCommand("brew", "install", name) {
+			t.Fatalf("did not expect %s to install on this host, got %+v", name, mr.Commands)
+		}
+	}
+}
+
 /* -----------------------------
    HandlePackages: config loop, skip optional
 ------------------------------ */
@@ -233,14 +374,54 @@ func TestHandlePackages_ConfigLoop_SkipOptional(t *testing.T) {
 	}
 
 	got := strings.Join(flattenCmds(mr), ";")
-	if !strings.Contains(got, "brew install a") || !strings.Contains(got, "brew install c") {
-		t.Fatalf("missing expected installs a/c, got: %s", got)
+	if !strings.Contains(got, "brew install a c") {
+		t.Fatalf("missing the batched install of a and c, got: %s", got)
 	}
 	if strings.Contains(got, "brew install b") {
 		t.Fatalf("should have skipped optional b")
 	}
 }
 
+func TestHandlePackages_Install_TapsBeforeInstall(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|tap", []byte("homebrew/core\nowner/already\n"), nil)
+
+	cfg := &models.Config{
+		Taps: []string{"owner/already", "team/global"},
+		Packages: []models.Package{
+			{Command: "owner/tools/foo"},
+			{Command: "bar", Tap: "owner/tools"},
+			{Command: "baz"},
+		},
+	}
+	b := NewBase(cfg, mr)
+
+	if err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"})); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	got := strings.Join(flattenCmds(mr), ";")
+	for _, want := range []string{
+		"brew tap team/global",
+		"brew tap owner/tools",
+		"brew install owner/tools/foo owner/tools/bar baz",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q, got: %s", want, got)
+		}
+	}
+	if strings.Contains(got, "brew tap owner/already") {
+		t.Fatalf("should not re-tap an existing tap, got: %s", got)
+	}
+	if strings.Count(got, "brew tap owner/tools") != 1 {
+		t.Fatalf("expected owner/tools to be tapped once, got: %s", got)
+	}
+	if strings.Index(got, "brew tap owner/tools") > strings.Index(got, "brew install owner/tools/foo") {
+		t.Fatalf("expected tap before install, got: %s", got)
+	}
+}
+
 func flattenCmds(m *runner.MockRunner) []string {
 	out := make([]string, 0, len(m.Commands))
 	for _, c := range m.Commands {
@@ -333,6 +514,30 @@ func TestHandlePackages_Upgrade_OnlyWhenOutdated(t *testing.T) {
 	}
 }
 
+func TestHandlePackages_Upgrade_FetchesHEAD(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr, "foo")
+	writeOutdatedCache(t, map[string][2]string{
+		"foo": {"HEAD-abc", "HEAD-def"},
+	})
+
+	cfg := &models.Config{Packages: []models.Package{{Command: "foo", Args: models.StringList{"--HEAD", "--keep-tmp"}}}}
+	b := NewBase(cfg, mr)
+
+	opts := PackageHandlerOptions{
+		Action:       PackageAction{ActionVerb: "upgrade"},
+		Packages:     []string{"foo"},
+		ValidateFunc: func(string) bool { return true },
+	}
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !mr.VerifyCommand("brew", "upgrade", "--fetch-HEAD", "foo") {
+		t.Fatalf("expected brew upgrade --fetch-HEAD foo, got %+v", mr.Commands)
+	}
+}
+
 func TestHandlePackages_Upgrade_SkipsWhenNotOutdated(t *testing.T) {
 	withIsolatedState(t)
 	mr := runner.NewMockRunner()
@@ -479,3 +684,528 @@ func writeOutdatedCacheV2(t *testing.T, entries map[string][2]string) {
 		t.Fatalf("write cache: %v", err)
 	}
 }
+
+/* -----------------------------
+   Hooks
+------------------------------ */
+
+func TestHandlePackages_Install_RunsHooksInOrder(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	cfg := &models.Config{
+		Hooks: &models.Hooks{PreInstall: models.StringList{"global-pre"}, PostInstall: models.StringList{"global-post"}},
+		Packages: []models.Package{{
+			Command: "bat",
+			Hooks:   &models.Hooks{PreInstall: models.StringList{"pkg-pre"}, PostInstall: models.StringList{"bat cache --build"}},
+		}},
+	}
+	b := NewBase(cfg, mr)
+
+	opts := PackageHandlerOptions{
+		Action:   PackageAction{ActionVerb: "install"},
+		Packages: []string{"bat"},
+	}
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var got []string
+	for _, c := range mr.Commands {
+		switch {
+		case c.Name == "sh":
+			got = append(got, c.Args[1])
+			if !utils.Includes(c.Env, "KEG_PACKAGE=bat") || !utils.Includes(c.Env, "KEG_ACTION=install") {
+				t.Fatalf("hook env misses package or action: %v", c.Env)
+			}
+		case c.Name == "brew" && c.Args[0] == "install":
+			got = append(got, "brew install")
+		}
+	}
+	want := "global-pre, pkg-pre, brew install, bat cache --build, global-post"
+	if strings.Join(got, ", ") != want {
+		t.Fatalf("got %s, want %s", strings.Join(got, ", "), want)
+	}
+}
+
+func TestHandlePackages_FailingPreHookSkipsPackage(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	mr.AddResponse("sh|-c|exit 1", nil, errors.New("exit status 1"))
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "foo", Hooks: &models.Hooks{PreInstall: models.StringList{"exit 1"}}},
+		{Command: "bar"},
+	}}
+	b := NewBase(cfg, mr)
+
+	opts := DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"})
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("a failing pre hook must not abort the run: %v", err)
+	}
+	if mr.VerifyCommand("brew", "install", "foo") {
+		t.Fatalf("foo must be skipped, got %+v", mr.Commands)
+	}
+	if !mr.VerifyCommand("brew", "install", "bar") {
+		t.Fatalf("bar must still be installed, got %+v", mr.Commands)
+	}
+}
+
+func TestHandleSelectedPackage_LinksInstalledPackage(t *testing.T) {
+	withIsolatedState(t)
+	home := os.Getenv("HOME")
+	dotfiles := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dotfiles, "foo.conf"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mr := runner.NewMockRunner()
+	primeInstalled(mr, "foo")
+
+	cfg := &models.Config{Packages: []models.Package{{
+		Command: "foo",
+		Links:   []models.Link{{Source: "foo.conf", Target: "~/.config/foo/foo.conf"}},
+	}}}
+	b := NewBase(cfg, mr)
+	b.Links.Dir = dotfiles
+
+	action := PackageAction{ActionVerb: "install", SkipMessage: "%s already installed"}
+	if err := b.handleSelectedPackage(action, "foo", func(string) bool { return true }, false); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	dest, err := os.Readlink(filepath.Join(home, ".config", "foo", "foo.conf"))
+	if err != nil || dest != filepath.Join(dotfiles, "foo.conf") {
+		t.Fatalf("expected the link of an installed package, got %q, %v", dest, err)
+	}
+}
+
+func TestHandlePackages_DryRunOnlyReads(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr, "bat")
+	dry := &runner.DryRunner{Inner: mr}
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "bat"},
+		{Command: "owner/tools/foo", Pin: true, Hooks: &models.Hooks{PostInstall: models.StringList{"foo setup"}}},
+	}}
+	b := NewBase(cfg, dry)
+
+	opts := DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install", SkipMessage: "%s already installed"})
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, c := range mr.Commands {
+		if c.Name != "brew" || (c.Args[0] != "list" && c.Args[0] != "tap" && c.Args[0] != "info") {
+			t.Fatalf("dry run ran %s %v", c.Name, c.Args)
+		}
+	}
+	var got []string
+	for _, c := range dry.Commands() {
+		got = append(got, c.Name+" "+strings.Join(c.Args, " "))
+	}
+	want := "brew tap owner/tools, brew install owner/tools/foo, brew pin owner/tools/foo, sh -c foo setup"
+	if strings.Join(got, ", ") != want {
+		t.Fatalf("recorded %q, want %q", strings.Join(got, ", "), want)
+	}
+	if !b.IsPackageInstalled("foo") {
+		t.Fatal("the session must see foo as installed after a dry install")
+	}
+}
+
+func TestHandlePackages_PrefetchesBeforeInstalling(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr, "bat")
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "bat"},
+		{Command: "jq"},
+		{Command: "neovim", Args: models.StringList{"--HEAD"}},
+		{Command: "fd"},
+		{Command: "ripgrep", Env: map[string]string{"HOMEBREW_NO_INSTALL_FROM_API": "1"}},
+	}}
+	b := NewBase(cfg, mr)
+	b.Jobs = 3
+
+	opts := DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install", SkipMessage: "%s already installed"})
+	if err := b.HandlePackages(opts); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var fetched, installed []string
+	for _, c := range mr.Commands {
+		if c.Name != "brew" {
+			continue
+		}
+		switch c.Args[0] {
+		case "fetch":
+			if len(installed) > 0 {
+				t.Fatalf("fetch %v ran after an install", c.Args)
+			}
+			fetched = append(fetched, c.Args[len(c.Args)-1])
+		case "install":
+			installed = append(installed, strings.Join(c.Args[1:], " "))
+		}
+	}
+	slices.Sort(fetched)
+	if want := []string{"fd", "jq"}; !slices.Equal(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+	if want := []string{"jq fd", "--HEAD neovim", "ripgrep"}; !slices.Equal(installed, want) {
+		t.Errorf("installed %q, want %q", installed, want)
+	}
+}
+
+func TestHandlePackages_NoPrefetchWithOneJob(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr)
+
+	b := NewBase(&models.Config{Packages: []models.Package{{Command: "jq"}, {Command: "fd"}}}, mr)
+	b.Jobs = 1
+
+	if err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"})); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, c := range mr.Commands {
+		if c.Name == "brew" && c.Args[0] == "fetch" {
+			t.Fatalf("unexpected %v", c.Args)
+		}
+	}
+}
+
+func TestForEach_BoundsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	items := []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+	errs := forEach(items, 3, func(i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if i%2 == 1 {
+			return errors.New("odd")
+		}
+		return nil
+	})
+
+	if got := peak.Load(); got > 3 {
+		t.Errorf("%d calls ran at once, want at most 3", got)
+	}
+	for i, err := range errs {
+		if (err != nil) != (i%2 == 1) {
+			t.Errorf("errs[%d] = %v, errors must follow the order of items", i, err)
+		}
+	}
+}
+
+func TestHandlePackages_KeepGoing(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepGoing bool
+		wantFd    bool
+	}{
+		{name: "stops at the first failure", keepGoing: false, wantFd: false},
+		{name: "keep going", keepGoing: true, wantFd: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withIsolatedState(t)
+			mr := runner.NewMockRunner()
+			mr.AddResponse("brew|install|jq|fd|rg", nil, errors.New("exit status 1"))
+			mr.AddResponse("brew|install|jq", nil, errors.New("exit status 1"))
+			mr.AddResponse("brew|install|rg", nil, errors.New("exit status 1"))
+			primeInstalled(mr, "bat")
+
+			cfg := &models.Config{Packages: []models.Package{
+				{Command: "bat"}, {Command: "jq"}, {Command: "fd"}, {Command: "rg"},
+			}}
+			b := NewBase(cfg, mr)
+			b.KeepGoing = tt.keepGoing
+
+			err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install", SkipMessage: "%s already installed"}))
+			if err == nil || !strings.Contains(err.Error(), "package jq") {
+				t.Fatalf("expected the jq failure, got %v", err)
+			}
+			if got := mr.VerifyCommand("brew", "install", "fd"); got != tt.wantFd {
+				t.Errorf("fd installed: got %v, want %v", got, tt.wantFd)
+			}
+			if got := strings.Contains(err.Error(), "package rg"); got != tt.keepGoing {
+				t.Errorf("rg failure reported: got %v, want %v (%v)", got, tt.keepGoing, err)
+			}
+		})
+	}
+}
+
+func TestHandleSelectedPackage_Outcomes(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|install|jq", nil, errors.New("exit status 1"))
+	primeInstalled(mr, "bat")
+
+	b := NewBase(&models.Config{Packages: []models.Package{{Command: "bat"}, {Command: "jq"}, {Command: "fd"}}}, mr)
+	action := PackageAction{ActionVerb: "install", SkipMessage: "%s already installed"}
+	valid := func(string) bool { return true }
+
+	for name, want := range map[string]Outcome{"bat": OutcomeSkipped, "jq": OutcomeFailed, "fd": OutcomeOK} {
+		if got, _ := b.handleSelectedPackageWithSession(action, name, valid, false, nil); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestHandlePackages_BatchFallsBackPerPackage(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|install|jq|fd", nil, errors.New("exit status 1"))
+	mr.AddResponse("brew|install|jq", nil, errors.New("exit status 1"))
+	primeInstalled(mr)
+
+	b := NewBase(&models.Config{Packages: []models.Package{{Command: "jq"}, {Command: "fd"}}}, mr)
+	b.KeepGoing = true
+
+	err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"}))
+	if err == nil || !strings.Contains(err.Error(), "package jq") || strings.Contains(err.Error(), "package fd") {
+		t.Fatalf("expected jq alone to fail, got %v", err)
+	}
+	if !mr.VerifyCommand("brew", "install", "jq") || !mr.VerifyCommand("brew", "install", "fd") {
+		t.Fatalf("expected a retry per package, got %+v", flattenCmds(mr))
+	}
+}
+
+func TestHandlePackages_BatchLeavesOutCustomizedPackages(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr, "htop", "tmux", "git")
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "jq"},
+		{Command: "neovim", Args: models.StringList{"--HEAD"}},
+		{Command: "rust", Hooks: &models.Hooks{PostInstall: models.StringList{"rustup-init -y"}}},
+		{Command: "fd"},
+		{Command: "ripgrep", Env: map[string]string{"HOMEBREW_NO_INSTALL_CLEANUP": "1"}},
+		{Command: "htop"},
+		{Command: "tmux"},
+		{Command: "git", Hooks: &models.Hooks{PreUninstall: models.StringList{"git maintenance unregister"}}},
+	}}
+	b := NewBase(cfg, mr)
+
+	if err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install", SkipMessage: "%s already installed"})); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	uninstall := DefaultPackageHandlerOptions(PackageAction{ActionVerb: "uninstall"})
+	uninstall.Packages = []string{"htop", "tmux", "git"}
+	if err := b.HandlePackages(uninstall); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, want := range [][]string{
+		{"install", "jq", "fd"},
+		{"install", "--HEAD", "neovim"},
+		{"install", "rust"},
+		{"install", "ripgrep"},
+		{"uninstall", "htop", "tmux"},
+		{"uninstall", "git"},
+	} {
+		if !mr.VerifyCommand("brew", want...) {
+			t.Errorf("missing brew %v, got %+v", want, flattenCmds(mr))
+		}
+	}
+	if mr.VerifyCommand("brew", "install", "jq") || mr.VerifyCommand("brew", "uninstall", "htop") {
+		t.Errorf("batched packages must not be handed to brew again, got %+v", flattenCmds(mr))
+	}
+}
+
+func TestHandlePackages_UninstallSkipsMissingPackage(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr)
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "git", Hooks: &models.Hooks{PreUninstall: models.StringList{"git maintenance unregister"}}},
+	}}
+	b := NewBase(cfg, mr)
+
+	uninstall := DefaultPackageHandlerOptions(PackageAction{ActionVerb: "uninstall"})
+	uninstall.Packages = []string{"git"}
+	if err := b.HandlePackages(uninstall); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !mr.VerifyRunCount("sh", 0) || mr.VerifyCommand("brew", "uninstall", "git") {
+		t.Errorf("a package that is not installed gets neither its hook nor brew uninstall, got %+v", flattenCmds(mr))
+	}
+}
+
+func TestHandlePackages_BatchChunks(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr)
+
+	cfg := &models.Config{}
+	for i := range maxBatchSize + 3 {
+		cfg.Packages = append(cfg.Packages, models.Package{Command: fmt.Sprintf("pkg%02d", i)})
+	}
+	b := NewBase(cfg, mr)
+
+	if err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"})); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var sizes []int
+	for _, c := range mr.Commands {
+		if c.Name == "brew" && c.Args[0] == "install" {
+			sizes = append(sizes, len(c.Args)-1)
+		}
+	}
+	if want := []int{maxBatchSize, 3}; !slices.Equal(sizes, want) {
+		t.Fatalf("got brew install calls of %v packages, want %v", sizes, want)
+	}
+}
+
+func TestJournal_RecordsNewInstallsOnly(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|install|owner/tools/foo|fd", nil, errors.New("exit status 1"))
+	mr.AddResponse("brew|install|fd", nil, errors.New("exit status 1"))
+	primeInstalled(mr, "bat")
+
+	cfg := &models.Config{Packages: []models.Package{{Command: "bat"}, {Command: "owner/tools/foo"}, {Command: "fd"}}}
+	b := NewBase(cfg, mr)
+	if err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install", SkipMessage: "%s already installed"})); err == nil {
+		t.Fatal("expected the fd failure")
+	}
+	if got := b.Journal().Installed(); !slices.Equal(got, []string{"owner/tools/foo"}) {
+		t.Fatalf("journal = %v, want the one package this run installed", got)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	primeInstalled(mr, "jq", "fd")
+
+	path := filepath.Join(t.TempDir(), "keg.yml")
+	if err := os.WriteFile(path, []byte("before\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBase(&models.Config{Packages: []models.Package{{Command: "jq"}, {Command: "fd"}}}, mr)
+	b.journal.recordInstall("jq")
+	b.journal.recordInstall("fd")
+	for _, content := range []string{"first edit\n", "second edit\n"} {
+		if err := b.Journal().RecordManifest(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if !mr.VerifyCommand("brew", "uninstall", "fd", "jq") {
+		t.Errorf("expected fd then jq to be uninstalled, got %v", flattenCmds(mr))
+	}
+	if data, _ := os.ReadFile(path); string(data) != "before\n" {
+		t.Errorf("keg.yml = %q, want its content before the run", data)
+	}
+	if !b.Journal().Empty() {
+		t.Error("the journal must start over after a rollback")
+	}
+}
+
+func TestRollbackAfter(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		name     string
+		err      error
+		atomic   bool
+		prompter prompter.Prompter
+		dry      bool
+		rollback bool
+	}{
+		{name: "success", err: nil, atomic: true},
+		{name: "atomic", err: cause, atomic: true, rollback: true},
+		{name: "confirmed", err: cause, prompter: confirm(true), rollback: true},
+		{name: "declined", err: cause, prompter: confirm(false)},
+		{name: "nobody to ask", err: cause},
+		{name: "dry run", err: cause, atomic: true, dry: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withIsolatedState(t)
+			mr := runner.NewMockRunner()
+			primeInstalled(mr, "jq")
+			var r runner.CommandRunner = mr
+			if tt.dry {
+				r = &runner.DryRunner{Inner: mr}
+			}
+			b := NewBase(&models.Config{Packages: []models.Package{{Command: "jq"}}}, r)
+			b.journal.recordInstall("jq")
+
+			if err := b.RollbackAfter(tt.err, tt.atomic, tt.prompter); !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want the error of the run", err)
+			}
+			if got := mr.VerifyCommand("brew", "uninstall", "jq"); got != tt.rollback {
+				t.Errorf("rolled back: got %v, want %v", got, tt.rollback)
+			}
+		})
+	}
+}
+
+type confirm bool
+
+func (c confirm) Confirm(string) (bool, error) { return bool(c), nil }
+func (confirm) Prompt(string) (string, error)  { return "", nil }
+
+func TestRollback_AfterBatchAndEarlyStop(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|install|--HEAD|neovim", nil, errors.New("exit status 1"))
+	primeInstalled(mr)
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "jq"},
+		{Command: "neovim", Args: models.StringList{"--HEAD"}},
+		{Command: "fd"},
+	}}
+	b := NewBase(cfg, mr)
+	err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"}))
+	if err == nil || !mr.VerifyCommand("brew", "install", "jq", "fd") {
+		t.Fatalf("expected jq and fd batched and neovim to fail, got %v (%v)", err, flattenCmds(mr))
+	}
+	if got := b.Journal().Installed(); !slices.Equal(got, []string{"jq", "fd"}) {
+		t.Fatalf("journal = %v, want the whole batch", got)
+	}
+	if len(b.batched) != 0 {
+		t.Fatalf("marks of the batch outlive the run: %v", b.batched)
+	}
+
+	// brew now reports what the batch installed
+	primeInstalled(mr, "jq", "fd")
+	if err := b.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if !mr.VerifyCommand("brew", "uninstall", "fd", "jq") {
+		t.Errorf("expected the batch to be uninstalled, got %v", flattenCmds(mr))
+	}
+}
+
+func TestHandlePackages_BatchToleratesPostInstallWarning(t *testing.T) {
+	withIsolatedState(t)
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|install|jq|fd", []byte(toleratedWarnings[0]+" for fd\n"), errors.New("exit status 1"))
+	primeInstalled(mr)
+
+	b := NewBase(&models.Config{Packages: []models.Package{{Command: "jq"}, {Command: "fd"}}}, mr)
+	if err := b.HandlePackages(DefaultPackageHandlerOptions(PackageAction{ActionVerb: "install"})); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if mr.VerifyCommand("brew", "install", "jq") || mr.VerifyCommand("brew", "install", "fd") {
+		t.Fatalf("a tolerated warning must not force the per-package fallback, got %v", flattenCmds(mr))
+	}
+}
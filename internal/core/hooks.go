@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/versions"
+)
+
+// hookTimeout bounds a single hook command; some (rustup-init) download a lot.
+const hookTimeout = 10 * time.Minute
+
+// hookStages maps a brew action to the hooks run before and after it.
+var hookStages = map[string][2]string{
+	"install":   {models.HookPreInstall, models.HookPostInstall},
+	"uninstall": {models.HookPreUninstall, ""},
+	"upgrade":   {"", models.HookPostUpgrade},
+}
+
+// runHooks runs the commands of a stage for pkg: the global hooks of
+// keg.yml around the ones of the package (global first before the action,
+// last after it). Each command runs with `sh -c` and gets KEG_PACKAGE,
+// KEG_VERSION, KEG_ACTION and KEG_HOOK in its environment. It stops at the
+// first failing command.
+func (b *Base) runHooks(pkg *models.Package, action, stage string) error {
+	if stage == "" {
+		return nil
+	}
+
+	var cmds []string
+	if stage == hookStages[action][0] {
+		cmds = append(append(cmds, b.Config.Hooks.For(stage)...), pkg.Hooks.For(stage)...)
+	} else {
+		cmds = append(append(cmds, pkg.Hooks.For(stage)...), b.Config.Hooks.For(stage)...)
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	name := pkg.FormulaName()
+	env := []string{
+		"KEG_PACKAGE=" + name,
+		"KEG_VERSION=" + b.installedVersion(pkg),
+		"KEG_ACTION=" + action,
+		"KEG_HOOK=" + stage,
+	}
+	ctx := runner.WithEnv(context.Background(), env)
+
+	for _, c := range cmds {
+		logger.Info("Running %s hook for %s: %s", stage, name, c)
+		if _, err := b.Runner.Run(ctx, hookTimeout, runner.Stream, "sh", "-c", c); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", stage, c, err)
+		}
+	}
+	return nil
+}
+
+// installedVersion asks brew for the version of pkg installed right now,
+// bypassing the version cache that lags behind during a run.
+func (b *Base) installedVersion(pkg *models.Package) string {
+	info, err := versions.NewResolver(b.Runner).Formulae(context.Background(), []string{pkg.FullName()})
+	if err != nil {
+		logger.Debug("version lookup for hooks failed (%s): %v", pkg.FormulaName(), err)
+		return ""
+	}
+	return info[pkg.FormulaName()].Installed
+}
+
+// hasHooks reports whether action runs any hook, global or of pkg, around
+// the brew call on pkg.
+func (b *Base) hasHooks(pkg *models.Package, action string) bool {
+	for _, stage := range hookStages[action] {
+		if stage != "" && len(b.Config.Hooks.For(stage))+len(pkg.Hooks.For(stage)) > 0 {
+			return true
+		}
+	}
+	return false
+}
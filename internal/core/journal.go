@@ -0,0 +1,131 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/prompter"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+// Journal records what a run changed, so that Rollback can undo it: the
+// packages it installed that were not there before, and the content of the
+// manifests it edited.
+type Journal struct {
+	installed []string
+	manifests []manifestBackup
+}
+
+type manifestBackup struct {
+	path string
+	data []byte
+	perm os.FileMode
+}
+
+// RecordManifest keeps the content path has before the run edits it. Only
+// the first call for a path counts.
+func (j *Journal) RecordManifest(path string) error {
+	for _, m := range j.manifests {
+		if m.path == path {
+			return nil
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	j.manifests = append(j.manifests, manifestBackup{path: path, data: data, perm: info.Mode().Perm()})
+	return nil
+}
+
+// Installed returns the packages the run installed, in install order.
+func (j *Journal) Installed() []string {
+	return slices.Clone(j.installed)
+}
+
+// Empty reports whether the run changed nothing Rollback would undo.
+func (j *Journal) Empty() bool {
+	return len(j.installed) == 0 && len(j.manifests) == 0
+}
+
+// recordInstall adds name once: a batched install records its packages
+// before the per-package loop gets to them.
+func (j *Journal) recordInstall(name string) {
+	if !slices.Contains(j.installed, name) {
+		j.installed = append(j.installed, name)
+	}
+}
+
+// Journal returns the journal of the current run.
+func (b *Base) Journal() *Journal {
+	return &b.journal
+}
+
+// Rollback undoes the journal: it uninstalls the packages of the run, last
+// installed first, then puts the edited manifests back. It tries every step
+// and returns the failures joined; the journal starts over either way.
+func (b *Base) Rollback() error {
+	j := b.journal
+	b.journal = Journal{}
+
+	var failures []error
+	if len(j.installed) > 0 {
+		names := slices.Clone(j.installed)
+		slices.Reverse(names)
+		logger.Info("Rolling back: uninstalling %s", strings.Join(names, ", "))
+
+		opts := DefaultPackageHandlerOptions(PackageAction{Name: "Uninstalling", ActionVerb: "uninstall"})
+		opts.Packages = names
+		opts.AllowAdHoc = true
+		// Batched installs the loop never got to are not in the cache yet
+		b.installedPkgs = make(map[string]bool)
+		keepGoing := b.KeepGoing
+		b.KeepGoing = true
+		failures = append(failures, b.HandlePackages(opts))
+		b.KeepGoing = keepGoing
+	}
+
+	for _, m := range slices.Backward(j.manifests) {
+		if err := os.WriteFile(m.path, m.data, m.perm); err != nil {
+			failures = append(failures, fmt.Errorf("failed to restore %s: %w", m.path, err))
+			continue
+		}
+		logger.Info("Restored %s", m.path)
+	}
+	return errors.Join(failures...)
+}
+
+// RollbackAfter is how a run that failed with err offers to undo what it
+// did: right away when atomic is set, else when the user confirms through p.
+// Without p, or when nothing changed, err is returned as is. A dry run
+// changed nothing.
+func (b *Base) RollbackAfter(err error, atomic bool, p prompter.Prompter) error {
+	if err == nil || b.journal.Empty() || runner.IsDryRun(b.Runner) {
+		return err
+	}
+	if !atomic {
+		if p == nil {
+			return err
+		}
+		question := fmt.Sprintf("Roll back this run (%d package(s) installed, %d manifest(s) edited)?",
+			len(b.journal.installed), len(b.journal.manifests))
+		if ok, perr := p.Confirm(question); perr != nil || !ok {
+			logger.Info("Leaving the changes in place; --atomic rolls back without asking")
+			return err
+		}
+	}
+
+	if rerr := b.Rollback(); rerr != nil {
+		return errors.Join(err, fmt.Errorf("rollback incomplete: %w", rerr))
+	}
+	logger.Success("Rolled back the changes of this run")
+	return err
+}
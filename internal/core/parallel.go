@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+// FlagJobs is the global --jobs flag: how many packages HandlePackages
+// downloads at once before installing them.
+var FlagJobs = 1
+
+// fetchTimeout bounds the download of one package and its dependencies.
+const fetchTimeout = 15 * time.Minute
+
+// prefetch downloads the packages HandlePackages is about to install or
+// upgrade, b.Jobs at a time, so that the brew install/upgrade calls that
+// follow only have to pour them. Those calls take brew's lock and stay one at
+// a time; `brew fetch` does not. Failures are only logged: the install that
+// follows downloads the package again and reports the actual error.
+//
+// The workers only run brew: what to fetch is decided beforehand, so the
+// caches of Base (installedPkgs, upgradedPkgs) stay on the calling goroutine.
+func (b *Base) prefetch(action string, names []string, allowAdHoc bool, session *BrewSessionState) {
+	if b.Jobs < 2 || runner.IsDryRun(b.Runner) {
+		return
+	}
+	var pkgs []*models.Package
+	for _, name := range names {
+		if pkg := b.fetchable(action, name, allowAdHoc, session); pkg != nil {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	if len(pkgs) < 2 {
+		return
+	}
+
+	logger.Info("Downloading %d packages, %d at a time...", len(pkgs), min(b.Jobs, len(pkgs)))
+	// Each worker gets its own brew process; none of them may auto-update,
+	// which takes the lock.
+	ctx := runner.WithEnv(context.Background(), []string{"HOMEBREW_NO_AUTO_UPDATE=1"})
+	errs := forEach(pkgs, b.Jobs, func(pkg *models.Package) error {
+		args := []string{"fetch", pkg.FullName()}
+		if action == "install" {
+			args = []string{"fetch", "--deps", pkg.FullName()}
+		}
+		_, err := b.Runner.Run(ctx, fetchTimeout, runner.Capture, "brew", args...)
+		return err
+	})
+	// Reported in manifest order once all workers are done
+	for i, err := range errs {
+		if err != nil {
+			logger.Debug("download of %s failed, brew %s will retry: %v", pkgs[i].FormulaName(), action, err)
+		}
+	}
+}
+
+// fetchable returns the package name stands for when action would download
+// it: not installed yet for an install, outdated for an upgrade. Packages
+// with brew flags (--HEAD, --build-from-source) or env are left to brew, as
+// in batchablePackage: a HOMEBREW_* variable can change what gets fetched.
+func (b *Base) fetchable(action, name string, allowAdHoc bool, session *BrewSessionState) *models.Package {
+	pkg, err := b.resolvePackageScoped(name, allowAdHoc)
+	if err != nil || len(pkg.Args) > 0 || len(pkg.Env) > 0 || !pkg.AvailableOn(b.Host) {
+		return nil
+	}
+	installed := b.IsPackageInstalled(pkg.FormulaName())
+	switch action {
+	case "install":
+		if !installed {
+			return pkg
+		}
+	case "upgrade":
+		if !installed || pkg.IsPinned() || session == nil || session.State == nil {
+			return nil
+		}
+		if _, outdated := session.State.Outdated[pkg.FormulaName()]; outdated {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// forEach calls fn on every item, with at most jobs calls at a time, and
+// returns their errors in the order of items.
+func forEach[T any](items []T, jobs int, fn func(T) error) []error {
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, max(jobs, 1))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(item)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/printer"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+// FlagKeepGoing is the global --keep-going flag: HandlePackages carries on
+// after a package fails and reports every failure at the end.
+var FlagKeepGoing bool
+
+// Outcome is what HandlePackages did with one package.
+type Outcome string
+
+const (
+	OutcomeOK      Outcome = "ok"
+	OutcomeSkipped Outcome = "skipped"
+	OutcomeFailed  Outcome = "failed"
+)
+
+// PackageResult is the outcome of one package in a HandlePackages run.
+type PackageResult struct {
+	Name     string
+	Outcome  Outcome
+	Err      error
+	Duration time.Duration
+}
+
+// handleAll runs the action on every name in turn. Without KeepGoing it
+// stops at the first failure; with it, it handles them all, prints a
+// summary and returns the failures joined.
+func (b *Base) handleAll(opts PackageHandlerOptions, names []string, session *BrewSessionState) error {
+	results := make([]PackageResult, 0, len(names))
+	var failures []error
+
+	for _, name := range names {
+		start := time.Now()
+		outcome, err := b.handleSelectedPackageWithSession(opts.Action, name, opts.ValidateFunc, opts.AllowAdHoc, session)
+		if err != nil {
+			err = fmt.Errorf("failed to %s package %s: %w", opts.Action.ActionVerb, name, err)
+			if !b.KeepGoing {
+				return err
+			}
+			logger.LogError("%v", err)
+			failures = append(failures, err)
+		}
+		results = append(results, PackageResult{Name: name, Outcome: outcome, Err: err, Duration: time.Since(start)})
+	}
+
+	if b.KeepGoing && !runner.IsDryRun(b.Runner) {
+		if err := renderResults(results); err != nil {
+			logger.Debug("cannot print the summary: %v", err)
+		}
+	}
+	return errors.Join(failures...)
+}
+
+func renderResults(results []PackageResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	p := printer.NewColorPrinter()
+	table := logger.CreateTable([]string{"Package", "Result", "Duration", "Error"})
+	for _, r := range results {
+		outcome, detail := string(r.Outcome), ""
+		switch r.Outcome {
+		case OutcomeOK:
+			outcome = p.Success(outcome)
+		case OutcomeSkipped:
+			outcome = p.Info(outcome)
+		case OutcomeFailed:
+			outcome, detail = p.Error(outcome), errors.Unwrap(r.Err).Error()
+		}
+		row := []string{r.Name, outcome, r.Duration.Round(100 * time.Millisecond).String(), detail}
+		if err := table.Append(row); err != nil {
+			return fmt.Errorf("append to table: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("render table: %w", err)
+	}
+	return nil
+}
@@ -19,7 +19,9 @@ You can delete specific packages or use --all to delete all packages from config
 Examples:
   keg delete bat             # Delete single package
   keg delete bat starship    # Delete multiple packages
-  keg delete --all          # Delete all packages from config`,
+  keg delete --all          # Delete all packages from config
+  keg delete --group k8s    # Delete the packages of the k8s group`,
+		Annotations: dryRunnable,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
 			if err != nil {
@@ -41,18 +43,16 @@ Examples:
 				return err
 			}
 
-			// Validate flags combo
-			if !allFlag && len(args) == 0 {
-				return middleware.FlagComboError(errs.ProvidePkgsOrAll, "Delete", "delete")
-			}
-			if allFlag && len(args) > 0 {
-				return middleware.FlagComboError(errs.AllWithNamedPackages, "Delete", "delete", "")
+			groupFlag, err := cmd.Flags().GetStringSlice("group")
+			if err != nil {
+				return err
 			}
-			if removeFlag && allFlag && !forceFlag {
-				return middleware.FlagComboError(errs.AllWithRemoveNeedsForce)
+
+			if err := validateDeleteFlags(allFlag, removeFlag, forceFlag, groupFlag, args); err != nil {
+				return err
 			}
 
-			return uninstall.New(cfg, nil).Execute(args, allFlag, removeFlag, forceFlag)
+			return uninstall.New(cfg, nil).Execute(args, allFlag, removeFlag, forceFlag, groupFlag)
 		},
 	}
 
@@ -60,6 +60,27 @@ Examples:
 	cmd.Flags().BoolP("all", "a", false, "Delete all packages listed in keg.yml (system only)")
 	cmd.Flags().BoolP("remove", "r", false, "Also remove package(s) from keg.yml after uninstall")
 	cmd.Flags().BoolP("force", "f", false, "Required with --all --remove to purge the manifest")
+	cmd.Flags().StringSliceP("group", "g", nil, "Delete the packages of these groups")
 
 	return cmd
 }
+
+func validateDeleteFlags(all, remove, force bool, groups []string, args []string) error {
+	// Validate flags combo
+	if !all && len(args) == 0 && len(groups) == 0 {
+		return middleware.FlagComboError(errs.ProvidePkgsOrAll, "Delete", "delete")
+	}
+	if all && len(groups) > 0 {
+		return middleware.FlagComboError(errs.AllWithGroup, "Delete", "delete")
+	}
+	if len(groups) > 0 && len(args) > 0 {
+		return middleware.FlagComboError(errs.GroupWithNamedPackages, "Delete", "delete")
+	}
+	if all && len(args) > 0 {
+		return middleware.FlagComboError(errs.AllWithNamedPackages, "Delete", "delete", "")
+	}
+	if remove && all && !force {
+		return middleware.FlagComboError(errs.AllWithRemoveNeedsForce)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"github.com/MrSnakeDoc/keg/internal/core"
 	"github.com/MrSnakeDoc/keg/internal/deploy"
+	"github.com/MrSnakeDoc/keg/internal/errs"
 	"github.com/MrSnakeDoc/keg/internal/middleware"
 	"github.com/MrSnakeDoc/keg/internal/models"
 
@@ -9,7 +11,7 @@ import (
 )
 
 func NewDeployCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "deploy",
 		Short: "Deploy the complete development environment",
 		Long: `Deploy and configure the complete development environment.
@@ -18,14 +20,37 @@ This includes:
 - Installing Homebrew if not present
 - Installing all configured packages
 - Running post-installation steps`,
+		Annotations: dryRunnable,
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
 			if err != nil {
 				return err
 			}
 
+			atomicFlag, err := cmd.Flags().GetBool("atomic")
+			if err != nil {
+				return err
+			}
+
+			d := deploy.New(cfg, nil)
+			// --keep-going is the default of deploy, --keep-going=false or
+			// --atomic opt out
+			if cmd.Flags().Changed("keep-going") {
+				d.KeepGoing = core.FlagKeepGoing
+			}
+			if atomicFlag && cmd.Flags().Changed("keep-going") && core.FlagKeepGoing {
+				return middleware.FlagComboError(errs.AtomicWithKeepGoing, "deploy")
+			}
+			if atomicFlag {
+				d.Atomic, d.KeepGoing = true, false
+			}
+
 			// Run deployment
-			return deploy.New(cfg, nil).Execute()
+			return d.Execute()
 		},
 	}
+
+	cmd.Flags().Bool("atomic", false, "Uninstall what this run installed if a package fails, without asking")
+
+	return cmd
 }
@@ -3,12 +3,14 @@ package deploy
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"time"
 
 	"github.com/MrSnakeDoc/keg/internal/install"
 	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/prompter"
 	"github.com/MrSnakeDoc/keg/internal/runner"
 	"github.com/MrSnakeDoc/keg/internal/utils"
 )
@@ -16,16 +18,24 @@ import (
 type Deployer struct {
 	Config *models.Config
 	Runner runner.CommandRunner
+	// KeepGoing installs every package even when some fail; on by default,
+	// a fresh machine is better off with 59 of its 60 packages.
+	KeepGoing bool
+	// Atomic uninstalls what a failed run installed without asking Prompter.
+	Atomic   bool
+	Prompter prompter.Prompter
 }
 
 func New(config *models.Config, r runner.CommandRunner) *Deployer {
 	if r == nil {
-		r = &runner.ExecRunner{}
+		r = runner.New()
 	}
 
 	return &Deployer{
-		Config: config,
-		Runner: r,
+		Config:    config,
+		Runner:    r,
+		KeepGoing: true,
+		Prompter:  prompter.New(os.Stdin, os.Stdout),
 	}
 }
 
@@ -49,6 +59,7 @@ func (d *Deployer) Execute() error {
 	}
 
 	logger.Success("Development environment deployed successfully!")
+	logger.Info("Add 'eval \"$(keg shellenv zsh)\"' to ~/.zshrc to use it in new shells")
 	return nil
 }
 
@@ -108,7 +119,9 @@ func (d *Deployer) ExecuteBrewPackages() error {
 	}
 
 	inst := install.New(d.Config, d.Runner)
-	if err := inst.Execute(nil, false, false, false, ""); err != nil {
+	inst.KeepGoing = d.KeepGoing
+	inst.Atomic, inst.Prompter = d.Atomic, d.Prompter
+	if err := inst.Execute(nil, false, false, false, "", nil, false); err != nil {
 		return fmt.Errorf("failed to install brew packages: %w", err)
 	}
 
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/doctor"
+
+	"github.com/spf13/cobra"
+)
+
+func NewDoctorCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the environment keg and brew run in",
+		Long: `Check the environment keg and brew run in, and suggest a fix for each
+problem found:
+  - brew is on PATH, in the prefix keg deploy sets up
+  - brew's bin directory comes before /usr/bin on PATH
+  - a startup file of your shell runs keg shellenv
+  - the manifest keg uses exists
+  - the state and cache files under ~/.local/state/keg parse
+  - the search index is fresh and matches its meta.json
+  - no other keg binary shadows this one
+
+It exits with an error when a check fails; warnings are only reported.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return doctor.New(nil).Execute()
+		},
+	}
+}
@@ -0,0 +1,286 @@
+package doctor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/shellenv"
+	"github.com/MrSnakeDoc/keg/internal/store"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+// startupFiles lists, per shell, the files a login or interactive shell
+// reads, relative to the home directory.
+var startupFiles = map[string][]string{
+	models.ShellZsh:  {".zshenv", ".zprofile", ".zshrc", ".zlogin"},
+	models.ShellBash: {".bash_profile", ".bash_login", ".profile", ".bashrc"},
+	models.ShellFish: {".config/fish/config.fish"},
+}
+
+func (d *Doctor) checkBrew() Result {
+	r := Result{Check: "brew"}
+	path, err := exec.LookPath("brew")
+	if err != nil {
+		r.Status, r.Detail = StatusFail, "brew not found on PATH"
+		r.Fix = "run 'keg deploy' to install Homebrew, or add its bin directory to PATH"
+		return r
+	}
+
+	out, err := d.Runner.Run(context.Background(), 30*time.Second, runner.Capture, "brew", "--prefix")
+	if err != nil {
+		r.Status, r.Detail = StatusFail, fmt.Sprintf("%s --prefix failed: %v", path, err)
+		r.Fix = "run 'brew doctor' to repair the Homebrew installation"
+		return r
+	}
+	d.prefix = strings.TrimSpace(string(out))
+
+	// keg looks for brew where $HOMEBREW_PREFIX says, by default where keg
+	// deploy installs it
+	if want := utils.HomebrewPrefix(); d.prefix != want {
+		r.Status = StatusWarn
+		r.Detail = fmt.Sprintf("brew lives in %s, keg looks in %s", d.prefix, want)
+		r.Fix = fmt.Sprintf("export HOMEBREW_PREFIX=%s before running keg", d.prefix)
+		return r
+	}
+	r.Status, r.Detail = StatusPass, fmt.Sprintf("%s (prefix %s)", path, d.prefix)
+	return r
+}
+
+func (d *Doctor) checkPath() Result {
+	r := Result{Check: "PATH"}
+	prefix := d.prefix
+	if prefix == "" {
+		prefix = utils.HomebrewPrefix()
+	}
+	bin := filepath.Join(prefix, "bin")
+
+	brewAt, usrAt := -1, -1
+	for i, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		switch filepath.Clean(dir) {
+		case bin:
+			if brewAt < 0 {
+				brewAt = i
+			}
+		case "/usr/bin":
+			if usrAt < 0 {
+				usrAt = i
+			}
+		}
+	}
+
+	switch {
+	case brewAt < 0:
+		r.Status, r.Detail = StatusFail, bin+" is not on PATH"
+		r.Fix = `add eval "$(keg shellenv)" to your shell startup file`
+	case usrAt >= 0 && usrAt < brewAt:
+		r.Status, r.Detail = StatusWarn, bin+" comes after /usr/bin, system tools shadow brew's"
+		r.Fix = "move " + bin + " before /usr/bin in PATH, or source keg shellenv last"
+	default:
+		r.Status, r.Detail = StatusPass, bin+" comes before /usr/bin"
+	}
+	return r
+}
+
+func (d *Doctor) checkShellenv() Result {
+	r := Result{Check: "shellenv"}
+	shell, ok := shellenv.DetectShell()
+	if !ok {
+		r.Status, r.Detail = StatusWarn, fmt.Sprintf("$SHELL %q is not supported by keg shellenv", os.Getenv("SHELL"))
+		r.Fix = "set up the Homebrew environment of your shell by hand"
+		return r
+	}
+
+	brewOnly := ""
+	for _, name := range startupFiles[shell] {
+		path := filepath.Join(d.Home, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(data), "keg shellenv") {
+			r.Status, r.Detail = StatusPass, "sourced from "+path
+			return r
+		}
+		if brewOnly == "" && strings.Contains(string(data), "brew shellenv") {
+			brewOnly = path
+		}
+	}
+
+	fix := fmt.Sprintf(`add eval "$(keg shellenv %[1]s)" to ~/.%[1]src`, shell)
+	if shell == models.ShellFish {
+		fix = "add 'keg shellenv fish | source' to ~/.config/fish/config.fish"
+	}
+	r.Status, r.Fix = StatusWarn, fix
+	r.Detail = fmt.Sprintf("no %s startup file runs keg shellenv", shell)
+	if brewOnly != "" {
+		r.Detail = brewOnly + " runs brew shellenv: no completions nor init lines"
+	}
+	return r
+}
+
+func (d *Doctor) checkManifest() Result {
+	r := Result{Check: "manifest"}
+	cfg, err := globalconfig.LoadPersistentConfig()
+	if err != nil {
+		r.Status, r.Detail = StatusFail, err.Error()
+		r.Fix = "fix " + filepath.Join(globalconfig.Dir(), "config.yml") + " or run 'keg init'"
+		return r
+	}
+	path := cfg.Manifest()
+	if path == "" {
+		r.Status, r.Detail = StatusFail, "no manifest configured"
+		r.Fix = "run 'keg init'"
+		return r
+	}
+	if _, err := os.Stat(path); err != nil {
+		r.Status, r.Detail = StatusFail, path+" does not exist"
+		r.Fix = "restore it, or point keg at another one with 'keg init' or 'keg profile use'"
+		return r
+	}
+	r.Status, r.Detail = StatusPass, path
+	return r
+}
+
+// checkStateFiles parses the JSON caches and state files of keg. They are
+// all rebuilt when missing, so deleting a broken one is always safe.
+func (d *Doctor) checkStateFiles() Result {
+	r := Result{Check: "state files"}
+	dir := filepath.Join(d.Home, utils.CacheDir)
+
+	var broken []string
+	checked := 0
+	err := filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		checked++
+		if data, err := os.ReadFile(path); err != nil || !json.Valid(data) {
+			broken = append(broken, path)
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		r.Status, r.Detail = StatusFail, err.Error()
+		r.Fix = "check the permissions of " + dir
+	case len(broken) > 0:
+		r.Status, r.Detail = StatusFail, "cannot parse "+strings.Join(broken, ", ")
+		r.Fix = "delete them, keg rebuilds them: rm " + strings.Join(broken, " ")
+	default:
+		r.Status, r.Detail = StatusPass, fmt.Sprintf("%d file(s) in %s", checked, dir)
+	}
+	return r
+}
+
+// checkIndex checks the package index `keg search` downloads: it should
+// not be older than the refresh interval and must match its meta.json.
+func (d *Doctor) checkIndex() Result {
+	r := Result{Check: "search index", Fix: "run 'keg search <query> --refresh'"}
+	dir := filepath.Join(d.Home, globalconfig.DataDir)
+	if _, err := os.Stat(filepath.Join(dir, "meta.json")); err != nil {
+		r.Status, r.Detail = StatusWarn, "no index yet"
+		return r
+	}
+
+	st, err := store.NewFS(dir)
+	if err != nil {
+		r.Status, r.Detail = StatusFail, err.Error()
+		return r
+	}
+	ctx := context.Background()
+	meta, err := st.ReadMeta(ctx)
+	if err != nil {
+		r.Status, r.Detail = StatusFail, fmt.Sprintf("meta.json: %v", err)
+		return r
+	}
+	sum, err := checksum(ctx, st)
+	if err != nil {
+		r.Status, r.Detail = StatusFail, err.Error()
+		return r
+	}
+	if sum != meta.SHA256 {
+		r.Status, r.Detail = StatusFail, "SHA256 of the index does not match meta.json"
+		return r
+	}
+
+	if age := time.Since(meta.LastSuccess); age > globalconfig.RefreshInterval {
+		r.Status = StatusWarn
+		r.Detail = fmt.Sprintf("%d packages, last refreshed %s ago", meta.Count, age.Truncate(time.Hour))
+		return r
+	}
+	r.Status, r.Detail = StatusPass, fmt.Sprintf("%d packages, refreshed %s", meta.Count, meta.LastSuccess.Local().Format(time.DateTime))
+	return r
+}
+
+func checksum(ctx context.Context, st *store.FS) (string, error) {
+	rc, _, _, _, err := st.OpenIndexGZ(ctx)
+	if err != nil {
+		return "", fmt.Errorf("open index: %w", err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", fmt.Errorf("read index: %w", err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// checkShadowed looks for every keg on PATH: the first one wins, so the
+// running binary should be it and there should be no other.
+func (d *Doctor) checkShadowed() Result {
+	r := Result{Check: "keg binary"}
+	self, err := os.Executable()
+	if err == nil {
+		self = resolve(self)
+	}
+
+	var found []string
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		path := filepath.Join(dir, "keg")
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+			continue
+		}
+		if real := resolve(path); !seen[real] {
+			seen[real] = true
+			found = append(found, path)
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		r.Status, r.Detail = StatusWarn, "keg is not on PATH"
+		r.Fix = "add the directory of " + self + " to PATH"
+	case self != "" && resolve(found[0]) != self:
+		r.Status, r.Detail = StatusWarn, fmt.Sprintf("running %s but keg on PATH is %s", self, found[0])
+		r.Fix = "remove the copy you do not use"
+	case len(found) > 1:
+		r.Status, r.Detail = StatusWarn, fmt.Sprintf("%s shadows %s", found[0], strings.Join(found[1:], ", "))
+		r.Fix = "remove the shadowed copies: rm " + strings.Join(found[1:], " ")
+	default:
+		r.Status, r.Detail = StatusPass, found[0]
+	}
+	return r
+}
+
+func resolve(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return path
+}
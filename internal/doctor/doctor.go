@@ -0,0 +1,116 @@
+package doctor
+
+import (
+	"fmt"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/printer"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Result is the outcome of one check; Fix tells the user what to do about
+// a warning or a failure.
+type Result struct {
+	Check  string
+	Status Status
+	Detail string
+	Fix    string
+}
+
+type Doctor struct {
+	Runner runner.CommandRunner
+	// Home is where the shell startup files and the state of keg are.
+	Home string
+	// prefix is the one brew reports, once the brew check ran.
+	prefix string
+}
+
+func New(r runner.CommandRunner) *Doctor {
+	if r == nil {
+		r = &runner.ExecRunner{}
+	}
+	return &Doctor{
+		Runner: r,
+		Home:   utils.GetHomeDir(),
+	}
+}
+
+// Run runs every check, in an order where the later ones can rely on what
+// the earlier ones found (the brew prefix).
+func (d *Doctor) Run() []Result {
+	checks := []func() Result{
+		d.checkBrew,
+		d.checkPath,
+		d.checkShellenv,
+		d.checkManifest,
+		d.checkStateFiles,
+		d.checkIndex,
+		d.checkShadowed,
+	}
+	out := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		out = append(out, check())
+	}
+	return out
+}
+
+// Execute runs the checks and prints them with the fixes to apply. It
+// fails when a check failed; warnings are only reported.
+func (d *Doctor) Execute() error {
+	results := d.Run()
+	if err := render(results); err != nil {
+		return err
+	}
+
+	failed, warned := 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case StatusFail:
+			failed++
+		case StatusWarn:
+			warned++
+		default:
+			continue
+		}
+		logger.Info("%s: %s", r.Check, r.Fix)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	if warned == 0 {
+		logger.Success("Everything looks good")
+	}
+	return nil
+}
+
+func render(results []Result) error {
+	p := printer.NewColorPrinter()
+	table := logger.CreateTable([]string{"Check", "Status", "Details"})
+	for _, r := range results {
+		status := string(r.Status)
+		switch r.Status {
+		case StatusPass:
+			status = p.Success(status)
+		case StatusWarn:
+			status = p.Warning(status)
+		case StatusFail:
+			status = p.Error(status)
+		}
+		if err := table.Append([]string{r.Check, status, r.Detail}); err != nil {
+			return fmt.Errorf("append to table: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("render table: %w", err)
+	}
+	return nil
+}
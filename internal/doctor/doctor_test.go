@@ -0,0 +1,197 @@
+package doctor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/store"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+func newTestDoctor(t *testing.T) *Doctor {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return &Doctor{Runner: runner.NewMockRunner(), Home: home}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckBrew(t *testing.T) {
+	d := newTestDoctor(t)
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	if r := d.checkBrew(); r.Status != StatusFail {
+		t.Fatalf("expected a failure without brew, got %+v", r)
+	}
+
+	writeFile(t, filepath.Join(bin, "brew"), "#!/bin/sh\n")
+	mr := d.Runner.(*runner.MockRunner)
+	t.Setenv("HOMEBREW_PREFIX", "")
+	mr.AddResponse("brew|--prefix", []byte("/opt/homebrew\n"), nil)
+	r := d.checkBrew()
+	if r.Status != StatusWarn || d.prefix != "/opt/homebrew" {
+		t.Fatalf("expected a warning for another prefix, got %+v", r)
+	}
+	if !strings.Contains(r.Fix, "HOMEBREW_PREFIX=/opt/homebrew") {
+		t.Fatalf("expected the fix to export the actual prefix, got %q", r.Fix)
+	}
+
+	// Following the fix makes keg look in the right place
+	t.Setenv("HOMEBREW_PREFIX", "/opt/homebrew")
+	if r := d.checkBrew(); r.Status != StatusPass {
+		t.Fatalf("expected a pass once HOMEBREW_PREFIX matches, got %+v", r)
+	}
+	t.Setenv("HOMEBREW_PREFIX", "")
+
+	mr.AddResponse("brew|--prefix", []byte(utils.DefaultHomebrewPrefix+"\n"), nil)
+	if r := d.checkBrew(); r.Status != StatusPass {
+		t.Fatalf("expected a pass, got %+v", r)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	d := newTestDoctor(t)
+	d.prefix = "/opt/brew"
+
+	tests := []struct {
+		path string
+		want Status
+	}{
+		{path: "/opt/brew/bin:/usr/bin:/bin", want: StatusPass},
+		{path: "/usr/local/bin:/usr/bin:/opt/brew/bin/", want: StatusWarn},
+		{path: "/usr/bin:/bin", want: StatusFail},
+	}
+	for _, tt := range tests {
+		t.Setenv("PATH", tt.path)
+		if r := d.checkPath(); r.Status != tt.want {
+			t.Errorf("PATH=%s: got %+v, want %s", tt.path, r, tt.want)
+		}
+	}
+}
+
+func TestCheckShellenv(t *testing.T) {
+	d := newTestDoctor(t)
+	t.Setenv("SHELL", "/bin/zsh")
+
+	if r := d.checkShellenv(); r.Status != StatusWarn {
+		t.Fatalf("expected a warning without startup files, got %+v", r)
+	}
+	writeFile(t, filepath.Join(d.Home, ".zprofile"), `eval "$(/opt/brew/bin/brew shellenv)"`+"\n")
+	if r := d.checkShellenv(); r.Status != StatusWarn || r.Detail == "" {
+		t.Fatalf("expected a warning about brew shellenv, got %+v", r)
+	}
+	writeFile(t, filepath.Join(d.Home, ".zshrc"), `eval "$(keg shellenv zsh)"`+"\n")
+	if r := d.checkShellenv(); r.Status != StatusPass {
+		t.Fatalf("expected a pass, got %+v", r)
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	d := newTestDoctor(t)
+	t.Chdir(d.Home)
+	manifest := filepath.Join(d.Home, "keg.yml")
+	t.Setenv(globalconfig.ManifestEnv, manifest)
+
+	if r := d.checkManifest(); r.Status != StatusFail {
+		t.Fatalf("expected a failure for a missing manifest, got %+v", r)
+	}
+	writeFile(t, manifest, "packages: []\n")
+	if r := d.checkManifest(); r.Status != StatusPass {
+		t.Fatalf("expected a pass, got %+v", r)
+	}
+}
+
+func TestCheckStateFiles(t *testing.T) {
+	d := newTestDoctor(t)
+	if r := d.checkStateFiles(); r.Status != StatusPass {
+		t.Fatalf("a missing state directory is fine, got %+v", r)
+	}
+
+	dir := filepath.Join(d.Home, utils.CacheDir)
+	writeFile(t, filepath.Join(dir, "pkg_versions.json"), `{"bat": {}}`)
+	writeFile(t, filepath.Join(dir, "gzip", "meta.json"), `{"etag": `)
+	r := d.checkStateFiles()
+	if r.Status != StatusFail || r.Detail != "cannot parse "+filepath.Join(dir, "gzip", "meta.json") {
+		t.Fatalf("expected the truncated meta.json to be reported, got %+v", r)
+	}
+}
+
+func TestCheckIndex(t *testing.T) {
+	d := newTestDoctor(t)
+	if r := d.checkIndex(); r.Status != StatusWarn {
+		t.Fatalf("expected a warning without index, got %+v", r)
+	}
+
+	dir := filepath.Join(d.Home, globalconfig.DataDir)
+	st, err := store.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("not really gzip")
+	sum := sha256.Sum256(payload)
+	meta := store.Meta{SHA256: fmt.Sprintf("%x", sum[:]), Count: 2, LastSuccess: time.Now()}
+	if err := st.WriteIndexGZ(t.Context(), bytes.NewReader(payload), meta); err != nil {
+		t.Fatal(err)
+	}
+	if r := d.checkIndex(); r.Status != StatusPass {
+		t.Fatalf("expected a pass, got %+v", r)
+	}
+
+	meta.LastSuccess = time.Now().Add(-48 * time.Hour)
+	writeJSON(t, filepath.Join(dir, "meta.json"), meta)
+	if r := d.checkIndex(); r.Status != StatusWarn {
+		t.Fatalf("expected a stale index warning, got %+v", r)
+	}
+
+	meta.SHA256 = "deadbeef"
+	writeJSON(t, filepath.Join(dir, "meta.json"), meta)
+	if r := d.checkIndex(); r.Status != StatusFail {
+		t.Fatalf("expected a checksum failure, got %+v", r)
+	}
+}
+
+func TestCheckShadowed(t *testing.T) {
+	d := newTestDoctor(t)
+	first, second := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(first, "keg"), "#!/bin/sh\n")
+	writeFile(t, filepath.Join(second, "keg"), "#!/bin/sh\n")
+	t.Setenv("PATH", first+string(os.PathListSeparator)+second)
+
+	// The test binary is never the keg on PATH
+	if r := d.checkShadowed(); r.Status != StatusWarn {
+		t.Fatalf("expected a warning, got %+v", r)
+	}
+}
+
+func writeJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, string(data))
+}
@@ -11,6 +11,12 @@ const (
 	AllWithAddInvalid       Code = "ALL_WITH_ADD_INVALID"
 	OptOrBinRequireAdd      Code = "OPT_OR_BIN_REQUIRE_ADD"
 	BinarySinglePackageOnly Code = "BINARY_SINGLE_PACKAGE_ONLY"
+	AllWithGroup            Code = "ALL_WITH_GROUP"
+	GroupWithNamedPackages  Code = "GROUP_WITH_NAMED_PACKAGES"
+	GroupNeedsAddWithArgs   Code = "GROUP_NEEDS_ADD_WITH_ARGS"
+	FrozenWithAdd           Code = "FROZEN_WITH_ADD"
+	AtomicWithKeepGoing     Code = "ATOMIC_WITH_KEEP_GOING"
+	DepsWithGroup           Code = "DEPS_WITH_GROUP"
 )
 
 var messages = map[Code]string{
@@ -67,6 +73,72 @@ Reason:
 
 Usage:
   keg install foo --add --binary batcat`,
+
+	AllWithGroup: `Invalid flag combination: cannot combine --all with --group
+
+Usage:
+  - %[1]s everything listed in keg.yml:
+      keg %[2]s --all
+  - %[1]s every package of a group:
+      keg %[2]s --group k8s
+
+Reason:
+  --all targets everything, --group targets a subset of keg.yml.`,
+
+	GroupWithNamedPackages: `Invalid flag combination: cannot use --group with named packages
+
+Usage:
+  - %[1]s every package of a group:
+      keg %[2]s --group k8s
+  - %[1]s only specific packages:
+      keg %[2]s foo bar
+
+Reason:
+  --group selects packages from keg.yml, named args target an explicit subset.`,
+
+	GroupNeedsAddWithArgs: `Invalid flag combination: --group with named packages requires --add
+
+Usage:
+  - Install every package of a group:
+      keg install --group k8s
+  - Install packages and add them to a group in keg.yml:
+      keg install kubectx kubens --add --group k8s
+
+Reason:
+  Without --add, --group selects packages from keg.yml; with --add it tags the new entries.`,
+
+	FrozenWithAdd: `Invalid flag combination: cannot combine --frozen with --add
+
+Usage:
+  - Install exactly what keg.lock records:
+      keg install --frozen
+  - Add a package, then record it in keg.lock:
+      keg install foo --add && keg lock --update
+
+Reason:
+  --frozen refuses any change to the locked environment; --add changes the manifest.`,
+
+	AtomicWithKeepGoing: `Invalid flag combination: cannot combine --atomic with --keep-going
+
+Usage:
+  - Undo the whole run as soon as a package fails:
+      keg %[1]s --atomic
+  - Install every package that can be, and list the failures:
+      keg %[1]s --keep-going
+
+Reason:
+  --atomic stops at the first failure to roll back; --keep-going carries on past it.`,
+
+	DepsWithGroup: `Invalid flag combination: cannot combine --deps with --group
+
+Usage:
+  - List the packages of a group:
+      keg list --group k8s
+  - List the installed packages keg.yml does not list:
+      keg list --deps
+
+Reason:
+  groups are defined in keg.yml; --deps lists what is not in it.`,
 }
 
 func Msg(code Code, a ...any) string {
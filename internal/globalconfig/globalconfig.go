@@ -7,15 +7,50 @@ import (
 	"strings"
 	"time"
 
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/manifest"
 	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/plan"
+	"github.com/MrSnakeDoc/keg/internal/runner"
 	"github.com/MrSnakeDoc/keg/internal/utils"
 	"github.com/MrSnakeDoc/keg/internal/utils/pathutils"
 
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultProfile names the manifest set up by `keg init` (packages_file).
+const DefaultProfile = "default"
+
+// ManifestFile is the name of the manifest looked up from the current
+// directory, and ManifestEnv the variable that points at a manifest.
+const (
+	ManifestFile = "keg.yml"
+	ManifestEnv  = "KEG_MANIFEST"
+)
+
+var (
+	// FlagProfile is the --profile flag; it overrides active_profile.
+	FlagProfile string
+	// FlagManifest is the --manifest flag; it overrides every profile.
+	FlagManifest string
+)
+
 type PersistentConfig struct {
-	PackagesFile string `yaml:"packages_file"`
+	PackagesFile  string             `yaml:"packages_file,omitempty"`
+	ActiveProfile string             `yaml:"active_profile,omitempty"`
+	Profiles      map[string]Profile `yaml:"profiles,omitempty"`
+
+	// Set by LoadPersistentConfig: the profile in use ("" for a manifest
+	// given explicitly or found in the current directory) and its manifests
+	// as absolute paths. The first manifest is the one keg edits.
+	Profile   string   `yaml:"-"`
+	Manifests []string `yaml:"-"`
+}
+
+// Profile is a named set of manifests. The first one is the main keg.yml,
+// the others are merged below it like includes.
+type Profile struct {
+	Manifests []string `yaml:"manifests"`
 }
 
 const (
@@ -23,6 +58,8 @@ const (
 	configFile = "config.yml"
 
 	DataDir = ".local/state/keg/gzip"
+	// IncludeDir caches remote manifest includes, next to DataDir
+	IncludeDir = ".local/state/keg/includes"
 
 	// mounted volume in the container
 	BrewFormulaURL  = "https://formulae.brew.sh/api/formula.json"
@@ -38,6 +75,10 @@ const (
 
 	// Download security limit
 	MaxDownloadBytes = 40 * 1024 * 1024 // 40 MB
+
+	// Remote manifest includes (cached under IncludeDir)
+	IncludeRefreshInterval = 1 * time.Hour
+	MaxIncludeBytes        = 1 * 1024 * 1024 // 1 MB
 )
 
 func GetConfigDir(dirPath string) string {
@@ -46,36 +87,194 @@ func GetConfigDir(dirPath string) string {
 	return filepath.Join(home, dirPath)
 }
 
+// Dir returns the directory holding the global configuration.
+func Dir() string {
+	return GetConfigDir(configDir)
+}
+
+// ReadPersistentConfig reads the global configuration as stored, without
+// resolving any profile. A missing file yields an empty configuration.
+func ReadPersistentConfig() (*PersistentConfig, error) {
+	configPath := filepath.Join(GetConfigDir(configDir), configFile)
+
+	var cfg PersistentConfig
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err = yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config file: %w", err)
+	}
+	return &cfg, nil
+}
+
+// LoadPersistentConfig reads the global configuration and resolves the
+// manifests to use, first match wins:
+//   - --manifest, then $KEG_MANIFEST (the global configuration is optional)
+//   - --profile
+//   - a keg.yml in the current directory or one of its parents, unless it
+//     belongs to the active profile
+//   - active_profile, then packages_file
 func LoadPersistentConfig() (*PersistentConfig, error) {
-	fullConfigDir := GetConfigDir(configDir)
+	cfg, err := ReadPersistentConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if path := explicitManifest(); path != "" {
+		abs, err := AbsManifest(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Manifests = []string{abs}
+		return cfg, cfg.absPackagesFile()
+	}
+
+	name := FlagProfile
+	if name == "" {
+		name = cfg.ActiveProfile
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	manifests, profileErr := cfg.ProfileManifests(name)
 
-	configPath := filepath.Join(fullConfigDir, configFile)
+	if FlagProfile == "" {
+		if local := FindProjectManifest(); local != "" && !containsManifest(manifests, local) {
+			if profileErr == nil {
+				// say which file gets edited when it is not the profile's
+				logger.Info("Using %s found from the current directory instead of the %s profile", local, name)
+			}
+			cfg.Manifests = []string{local}
+			return cfg, cfg.absPackagesFile()
+		}
+	}
 
+	configPath := filepath.Join(GetConfigDir(configDir), configFile)
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("no configuration found. Please run 'keg init' first")
 	}
+	if profileErr != nil {
+		return nil, profileErr
+	}
 
-	data, err := os.ReadFile(configPath)
+	for _, m := range manifests {
+		absPath, err := pathutils.ToAbsolutePath(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve packages file path: %w", err)
+		}
+		if _, err := os.Stat(absPath); err != nil {
+			return nil, fmt.Errorf("packages file not found at %s: %w", m, err)
+		}
+		cfg.Manifests = append(cfg.Manifests, absPath)
+	}
+
+	cfg.Profile = name
+	return cfg, cfg.absPackagesFile()
+}
+
+func (c *PersistentConfig) absPackagesFile() error {
+	if c.PackagesFile == "" {
+		return nil
+	}
+	abs, err := pathutils.ToAbsolutePath(c.PackagesFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return fmt.Errorf("failed to resolve packages file path: %w", err)
 	}
+	c.PackagesFile = abs
+	return nil
+}
 
-	var cfg PersistentConfig
-	if err = yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config file: %w", err)
+// explicitManifest returns the manifest given with --manifest or
+// $KEG_MANIFEST, if any.
+func explicitManifest() string {
+	if FlagManifest != "" {
+		return FlagManifest
 	}
+	return strings.TrimSpace(os.Getenv(ManifestEnv))
+}
 
-	absPath, err := pathutils.ToAbsolutePath(cfg.PackagesFile)
+// AbsManifest resolves path against the current directory and checks that
+// the manifest exists.
+func AbsManifest(path string) (string, error) {
+	abs, err := pathutils.ToAbsolutePath(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve packages file path: %w", err)
+		return "", fmt.Errorf("failed to resolve packages file path: %w", err)
+	}
+	if abs, err = filepath.Abs(abs); err != nil {
+		return "", fmt.Errorf("failed to resolve packages file path: %w", err)
 	}
+	if _, err := os.Stat(abs); err != nil {
+		return "", fmt.Errorf("packages file not found at %s: %w", path, err)
+	}
+	return abs, nil
+}
 
-	if _, err := os.Stat(absPath); err != nil {
-		return nil, fmt.Errorf("packages file not found at %s: %w", cfg.PackagesFile, err)
+// FindProjectManifest looks for a keg.yml in the current directory and its
+// parents. The home directory is not searched: a keg.yml there is the one
+// `keg init` set up, reached through the global configuration.
+func FindProjectManifest() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	home := filepath.Clean(utils.GetHomeDir())
+
+	for {
+		if dir == home {
+			return ""
+		}
+		candidate := filepath.Join(dir, ManifestFile)
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
 	}
+}
 
-	cfg.PackagesFile = absPath
-	return &cfg, nil
+func containsManifest(manifests []string, path string) bool {
+	for _, m := range manifests {
+		if abs, err := pathutils.ToAbsolutePath(m); err == nil && filepath.Clean(abs) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileManifests returns the manifests of a profile as stored. The empty
+// name and DefaultProfile stand for packages_file.
+func (c *PersistentConfig) ProfileManifests(name string) ([]string, error) {
+	if name == "" || name == DefaultProfile {
+		if c.PackagesFile == "" {
+			return nil, fmt.Errorf("no packages file configured. Please run 'keg init' first")
+		}
+		return []string{c.PackagesFile}, nil
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, see 'keg profile list'", name)
+	}
+	if len(p.Manifests) == 0 {
+		return nil, fmt.Errorf("profile %q has no manifest", name)
+	}
+	return p.Manifests, nil
+}
+
+// Manifest returns the main manifest of the profile in use.
+func (c *PersistentConfig) Manifest() string {
+	if len(c.Manifests) > 0 {
+		return c.Manifests[0]
+	}
+	return c.PackagesFile
 }
 
 func (c *PersistentConfig) Save() error {
@@ -94,6 +293,15 @@ func (c *PersistentConfig) Save() error {
 	}
 	c.PackagesFile = homePath
 
+	for name, p := range c.Profiles {
+		for i, m := range p.Manifests {
+			if p.Manifests[i], err = pathutils.ToHomePathFormat(m); err != nil {
+				return fmt.Errorf("failed to convert to home path format: %w", err)
+			}
+		}
+		c.Profiles[name] = p
+	}
+
 	data, err := yaml.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
@@ -107,17 +315,32 @@ func (c *PersistentConfig) Save() error {
 	return nil
 }
 
+// ManifestPath returns the keg.yml SaveConfig writes to.
+func ManifestPath() (string, error) {
+	globalCfg, err := LoadPersistentConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load global config: %w", err)
+	}
+	return globalCfg.Manifest(), nil
+}
+
 func SaveConfig(cfg *models.Config) error {
 	fileRights := 0o644
 
-	globalCfg, err := LoadPersistentConfig()
+	path, err := ManifestPath()
 	if err != nil {
-		return fmt.Errorf("failed to load global config: %w", err)
+		return err
+	}
+
+	// keg.yml edited in place by the manifest package: write it verbatim.
+	if data, ok := manifest.Source(cfg); ok {
+		return saveManifest(path, data, os.FileMode(fileRights))
 	}
 
 	// Make a shallow copy so we don't mutate in-memory order.
+	// Packages merged from includes never end up in keg.yml.
 	cfgOut := *cfg
-	cfgOut.Packages = append([]models.Package(nil), cfg.Packages...)
+	cfgOut.Packages = cfg.LocalPackages()
 
 	// Sort: core first, optional last; alpha by Command (fallback to Binary)
 	utils.SortByTypeAndKey(cfgOut.Packages,
@@ -141,9 +364,22 @@ func SaveConfig(cfg *models.Config) error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(globalCfg.PackagesFile, data, os.FileMode(fileRights)); err != nil {
-		return fmt.Errorf("failed to write config to %s: %w", globalCfg.PackagesFile, err)
+	if err := saveManifest(path, data, os.FileMode(fileRights)); err != nil {
+		return err
 	}
+	cfg.Source = data
 
 	return nil
 }
+
+// saveManifest writes keg.yml, or only records the edit with --dry-run.
+func saveManifest(path string, data []byte, perm os.FileMode) error {
+	if runner.FlagDryRun {
+		plan.RecordEdit(path, data)
+		return nil
+	}
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("failed to write config to %s: %w", path, err)
+	}
+	return nil
+}
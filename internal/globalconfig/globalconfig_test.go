@@ -0,0 +1,123 @@
+package globalconfig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+)
+
+func writeManifest(t *testing.T, path string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("packages: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPersistentConfig_ManifestSources(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ManifestEnv, "")
+
+	configured := writeManifest(t, filepath.Join(home, "keg.yml"))
+	project := writeManifest(t, filepath.Join(home, "src", "app", ManifestFile))
+	explicit := writeManifest(t, filepath.Join(home, "ci", "keg.yml"))
+	nested := filepath.Join(home, "src", "app", "cmd", "tool")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		saved    bool
+		dir      string
+		flag     string
+		env      string
+		want     string
+		wantProf string
+	}{
+		{name: "configured manifest", saved: true, dir: home, want: configured, wantProf: DefaultProfile},
+		{name: "project manifest from a subdirectory", saved: true, dir: nested, want: project},
+		{name: "project manifest without global config", dir: nested, want: project},
+		{name: "env beats the project manifest", dir: nested, env: explicit, want: explicit},
+		{name: "flag beats env", dir: home, flag: explicit, env: configured, want: explicit},
+		{name: "relative flag", dir: filepath.Join(home, "ci"), flag: "keg.yml", want: explicit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = os.RemoveAll(filepath.Join(home, configDir))
+			if tt.saved {
+				if err := (&PersistentConfig{PackagesFile: configured}).Save(); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			t.Chdir(tt.dir)
+			t.Setenv(ManifestEnv, tt.env)
+			FlagManifest = tt.flag
+			defer func() { FlagManifest = "" }()
+
+			cfg, err := LoadPersistentConfig()
+			if err != nil {
+				t.Fatalf("LoadPersistentConfig: %v", err)
+			}
+			if cfg.Manifest() != tt.want || cfg.Profile != tt.wantProf {
+				t.Fatalf("got %s (profile %q), want %s (profile %q)", cfg.Manifest(), cfg.Profile, tt.want, tt.wantProf)
+			}
+		})
+	}
+}
+
+func TestLoadPersistentConfig_Errors(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ManifestEnv, "")
+	t.Chdir(home)
+
+	if _, err := LoadPersistentConfig(); err == nil || !strings.Contains(err.Error(), "keg init") {
+		t.Fatalf("expected a hint to run keg init, got %v", err)
+	}
+
+	t.Setenv(ManifestEnv, filepath.Join(home, "missing.yml"))
+	if _, err := LoadPersistentConfig(); err == nil || !strings.Contains(err.Error(), "packages file not found") {
+		t.Fatalf("expected a missing manifest error, got %v", err)
+	}
+}
+
+func TestLoadPersistentConfig_SaysWhenProjectManifestWins(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ManifestEnv, "")
+	configured := writeManifest(t, filepath.Join(home, "keg.yml"))
+	project := writeManifest(t, filepath.Join(home, "app", ManifestFile))
+	if err := (&PersistentConfig{PackagesFile: configured}).Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var out bytes.Buffer
+	logger.Configure(logger.Options{Level: "info", Out: &out})
+	t.Cleanup(logger.UseTestMode)
+
+	t.Chdir(home)
+	if _, err := LoadPersistentConfig(); err != nil {
+		t.Fatalf("LoadPersistentConfig: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing logged for the profile's own manifest, got %q", out.String())
+	}
+
+	t.Chdir(filepath.Dir(project))
+	if _, err := LoadPersistentConfig(); err != nil {
+		t.Fatalf("LoadPersistentConfig: %v", err)
+	}
+	if !strings.Contains(out.String(), project) || !strings.Contains(out.String(), DefaultProfile) {
+		t.Fatalf("expected the project manifest and the profile in the log, got %q", out.String())
+	}
+}
@@ -0,0 +1,370 @@
+package include
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/checker"
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/service"
+	"github.com/MrSnakeDoc/keg/internal/store"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+	"github.com/MrSnakeDoc/keg/internal/utils/pathutils"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrIncludeCycle = errors.New("include cycle detected")
+	errNotCached    = errors.New("not cached")
+)
+
+// Resolver loads the manifests listed under `include:` and merges them into
+// the local configuration.
+//
+// Precedence, from lowest to highest:
+//   - includes listed earlier
+//   - includes listed later
+//   - the local keg.yml
+//
+// A package overrides another one when both share the same formula name.
+// Includes can themselves include other manifests; nested includes sit
+// below the manifest that declares them.
+type Resolver struct {
+	Client   service.TextFetcher
+	CacheDir string
+	TTL      time.Duration
+	MaxDepth int
+	// Offline reads remote includes from the cache only, whatever their
+	// age, and skips the ones never fetched.
+	Offline bool
+}
+
+func NewResolver(client service.TextFetcher) *Resolver {
+	if client == nil {
+		client = service.NewAdvancedHTTPClient("keg/" + checker.Version)
+	}
+	return &Resolver{
+		Client:   client,
+		CacheDir: globalconfig.GetConfigDir(globalconfig.IncludeDir),
+		TTL:      globalconfig.IncludeRefreshInterval,
+		MaxDepth: 5,
+	}
+}
+
+// Resolve merges every include of cfg into cfg.Packages and cfg.IncludedTaps.
+// manifestPath is the keg.yml cfg was read from; relative include paths are
+// resolved against its directory. extra is merged below cfg.Include, as if
+// listed first (the other manifests of a profile).
+func (r *Resolver) Resolve(ctx context.Context, cfg *models.Config, manifestPath string, extra ...models.Include) error {
+	includes := append(append([]models.Include(nil), extra...), cfg.Include...)
+	if len(includes) == 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	stack := map[string]bool{filepath.Clean(manifestPath): true}
+	pkgs, taps, err := r.resolveAll(ctx, includes, filepath.Dir(manifestPath), stack, 1)
+	if err != nil {
+		return err
+	}
+
+	cfg.Packages = overlay(pkgs, cfg.Packages)
+	cfg.IncludedTaps = utils.Filter(dedupe(taps), func(t string) bool {
+		return !utils.Includes(cfg.Taps, t)
+	})
+	return nil
+}
+
+// resolveAll loads includes in order and overlays them, later ones winning.
+func (r *Resolver) resolveAll(
+	ctx context.Context,
+	incs []models.Include,
+	baseDir string,
+	stack map[string]bool,
+	depth int,
+) ([]models.Package, []string, error) {
+	if depth > r.MaxDepth {
+		return nil, nil, fmt.Errorf("includes nested deeper than %d levels", r.MaxDepth)
+	}
+
+	var (
+		pkgs []models.Package
+		taps []string
+	)
+
+	for i := range incs {
+		inc := incs[i]
+		if err := inc.Validate(); err != nil {
+			return nil, nil, err
+		}
+
+		key, data, childBase, err := r.load(ctx, &inc, baseDir)
+		if errors.Is(err, errNotCached) {
+			logger.Debug("include %s: no cached copy, skipped offline", inc.Source())
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("include %s: %w", inc.Source(), err)
+		}
+		if stack[key] {
+			return nil, nil, fmt.Errorf("%w: %s", ErrIncludeCycle, inc.Source())
+		}
+
+		var sub models.Config
+		if err := yaml.Unmarshal(data, &sub); err != nil {
+			return nil, nil, fmt.Errorf("include %s: failed to unmarshal YAML: %w", inc.Source(), err)
+		}
+
+		stack[key] = true
+		nested, nestedTaps, err := r.resolveAll(ctx, sub.Include, childBase, stack, depth+1)
+		delete(stack, key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for j := range sub.Packages {
+			sub.Packages[j].Origin = inc.Source()
+		}
+		if inc.URL != "" && inc.SHA256 == "" {
+			dropUntrusted(inc.Source(), sub.Packages)
+		}
+
+		pkgs = overlay(pkgs, overlay(nested, sub.Packages))
+		taps = append(taps, nestedTaps...)
+		taps = append(taps, sub.Taps...)
+	}
+
+	return pkgs, taps, nil
+}
+
+// dropUntrusted strips from packages of a remote include not pinned with
+// sha256 what could be turned against the machine: hooks and init lines run
+// shell commands, env and args change what brew builds, and links write into
+// the home directory. The URL can serve something else at any time without
+// keg.yml changing. Local files, like the other manifests of a profile, are
+// the user's own and keep theirs.
+func dropUntrusted(source string, pkgs []models.Package) {
+	var dropped []string
+	for j := range pkgs {
+		p := &pkgs[j]
+		if p.Hooks == nil && p.Init == nil && len(p.Env) == 0 && len(p.Args) == 0 && len(p.Links) == 0 {
+			continue
+		}
+		p.Hooks, p.Init, p.Env, p.Args, p.Links = nil, nil, nil, nil, nil
+		dropped = append(dropped, p.Command)
+	}
+	if len(dropped) > 0 {
+		logger.Warn("Ignoring the hooks, init, env, args and links of %s: include %s has no sha256",
+			strings.Join(dropped, ", "), source)
+	}
+}
+
+// load returns a cycle-detection key, the raw manifest and the directory
+// nested relative includes resolve against ("" for remote manifests).
+func (r *Resolver) load(ctx context.Context, inc *models.Include, baseDir string) (key string, data []byte, childBase string, err error) {
+	if inc.URL != "" {
+		if _, err := utils.ParseSecureURL(inc.URL); err != nil {
+			return "", nil, "", err
+		}
+		data, err = r.fetchRemote(ctx, inc.URL)
+		if err != nil {
+			return "", nil, "", err
+		}
+		key = inc.URL
+	} else {
+		path, err := r.localPath(inc.Path, baseDir)
+		if err != nil {
+			return "", nil, "", err
+		}
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		key, childBase = path, filepath.Dir(path)
+	}
+
+	if inc.SHA256 != "" {
+		if got := sha256Hex(data); !strings.EqualFold(got, inc.SHA256) {
+			return "", nil, "", fmt.Errorf("checksum mismatch: expected %s, got %s", inc.SHA256, got)
+		}
+	}
+	return key, data, childBase, nil
+}
+
+func (*Resolver) localPath(path, baseDir string) (string, error) {
+	abs, err := pathutils.ToAbsolutePath(path)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(abs) {
+		return filepath.Clean(abs), nil
+	}
+	if baseDir == "" {
+		return "", fmt.Errorf("relative path %q cannot be resolved from a remote include", path)
+	}
+	return filepath.Join(baseDir, abs), nil
+}
+
+// readCached returns the cached copy of an include and its metadata; a
+// missing or broken meta.json yields empty metadata.
+func readCached(bodyPath, metaPath string) ([]byte, store.Meta, error) {
+	var meta store.Meta
+	cached, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := utils.FileReader(metaPath, utils.FileTypeJSON, &meta); err != nil {
+		meta = store.Meta{}
+	}
+	return cached, meta, nil
+}
+
+// fetchRemote returns the manifest at url, using the on-disk copy while it
+// is younger than r.TTL and revalidating it with its ETag afterwards.
+// When the network fails, a cached copy is used with a warning.
+func (r *Resolver) fetchRemote(ctx context.Context, url string) ([]byte, error) {
+	name := sha256Hex([]byte(url))[:16]
+	bodyPath := filepath.Join(r.CacheDir, name+".yml")
+	metaPath := filepath.Join(r.CacheDir, name+".meta.json")
+
+	cached, meta, cerr := readCached(bodyPath, metaPath)
+	if r.Offline {
+		if cerr != nil {
+			return nil, errNotCached
+		}
+		return cached, nil
+	}
+
+	now := time.Now().UTC()
+	if cerr == nil && !meta.LastChecked.IsZero() && now.Sub(meta.LastChecked) < r.TTL {
+		logger.Debug("include %s: using cached copy (age=%s)", url, now.Sub(meta.LastChecked).Truncate(time.Second))
+		return cached, nil
+	}
+
+	prevETag := ""
+	if cerr == nil {
+		prevETag = meta.UpstreamETag
+	}
+
+	res, err := r.Client.FetchTextWithETag(ctx, url, prevETag, globalconfig.MaxIncludeBytes)
+	if err != nil {
+		if cerr == nil {
+			logger.Warn("include %s: %v; using cached copy", url, err)
+			return cached, nil
+		}
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+
+	switch res.Status {
+	case http.StatusNotModified:
+		if cerr != nil {
+			return nil, fmt.Errorf("got 304 Not Modified without a cached copy")
+		}
+		meta.LastChecked = now
+		r.writeMeta(metaPath, meta)
+		return cached, nil
+
+	case http.StatusOK:
+		data, err := readBody(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(r.CacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("mkdir %s: %w", r.CacheDir, err)
+		}
+		if err := utils.WriteFileAtomic(bodyPath+".tmp", bodyPath, bytes.NewReader(data)); err != nil {
+			logger.Debug("include %s: failed to cache: %v", url, err)
+		}
+		r.writeMeta(metaPath, store.Meta{
+			ETag:         "sha256:" + sha256Hex(data),
+			SHA256:       sha256Hex(data),
+			SizeBytes:    int64(len(data)),
+			UpstreamETag: res.ETag,
+			LastSuccess:  now,
+			LastChecked:  now,
+		})
+		return data, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected status %d", res.Status)
+	}
+}
+
+func (*Resolver) writeMeta(path string, m store.Meta) {
+	if err := utils.WriteJSONAtomic(path, m); err != nil {
+		logger.Debug("failed to write include meta %s: %v", path, err)
+	}
+}
+
+func readBody(body io.ReadCloser) (data []byte, err error) {
+	rc, err := utils.MaybeGunzip(body)
+	if err != nil {
+		_ = body.Close()
+		return nil, fmt.Errorf("gunzip: %w", err)
+	}
+
+	defer func() {
+		if cerr := rc.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close failed: %w", cerr)
+		}
+	}()
+
+	data, err = io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return data, nil
+}
+
+// overlay returns lower with every package redefined in upper replaced,
+// followed by upper.
+func overlay(lower, upper []models.Package) []models.Package {
+	if len(lower) == 0 {
+		return upper
+	}
+	shadowed := make(map[string]struct{}, len(upper))
+	for i := range upper {
+		shadowed[upper[i].FormulaName()] = struct{}{}
+	}
+	out := make([]models.Package, 0, len(lower)+len(upper))
+	for i := range lower {
+		if _, hit := shadowed[lower[i].FormulaName()]; hit {
+			continue
+		}
+		out = append(out, lower[i])
+	}
+	return append(out, upper...)
+}
+
+func dedupe(in []string) []string {
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if _, ok := seen[s]; ok || s == "" {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	return out
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
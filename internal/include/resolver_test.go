@@ -0,0 +1,296 @@
+package include
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/service"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+type fakeFetcher struct {
+	body  map[string]string
+	etag  string
+	calls []string // prevETag of each call
+	err   error
+}
+
+func (f *fakeFetcher) FetchTextWithETag(_ context.Context, url, prevETag string, _ int64) (service.FetchResult, error) {
+	f.calls = append(f.calls, prevETag)
+	if f.err != nil {
+		return service.FetchResult{}, f.err
+	}
+	if prevETag != "" && prevETag == f.etag {
+		return service.FetchResult{Status: http.StatusNotModified, ETag: f.etag}, nil
+	}
+	b, ok := f.body[url]
+	if !ok {
+		return service.FetchResult{Status: http.StatusNotFound}, nil
+	}
+	return service.FetchResult{
+		Status: http.StatusOK,
+		ETag:   f.etag,
+		Body:   io.NopCloser(strings.NewReader(b)),
+	}, nil
+}
+
+func newTestResolver(t *testing.T, f *fakeFetcher) *Resolver {
+	t.Helper()
+	return &Resolver{Client: f, CacheDir: t.TempDir(), TTL: time.Hour, MaxDepth: 5}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func byName(cfg *models.Config) map[string]models.Package {
+	out := make(map[string]models.Package, len(cfg.Packages))
+	for _, p := range cfg.Packages {
+		out[p.FormulaName()] = p
+	}
+	return out
+}
+
+func TestResolve_LocalIncludes_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "base.yml"), `
+taps: [hashicorp/tap]
+packages:
+  - command: fd
+  - command: ripgrep
+    binary: rg
+  - command: bat
+`)
+	writeFile(t, filepath.Join(dir, "team.yml"), `
+packages:
+  - command: ripgrep
+    optional: true
+`)
+
+	cfg := models.Config{
+		Include: []models.Include{{Path: "base.yml"}, {Path: "team.yml"}},
+		Packages: []models.Package{
+			{Command: "bat", Pin: true},
+		},
+	}
+
+	r := newTestResolver(t, &fakeFetcher{})
+	if err := r.Resolve(context.Background(), &cfg, filepath.Join(dir, "keg.yml")); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	got := byName(&cfg)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 packages, got %+v", cfg.Packages)
+	}
+	if p := got["ripgrep"]; !p.Optional || p.Binary != "" {
+		t.Fatalf("later include must win, got %+v", p)
+	}
+	if p := got["bat"]; !p.Pin || p.Origin != "" {
+		t.Fatalf("local package must win, got %+v", p)
+	}
+	if p := got["fd"]; p.Origin != "base.yml" {
+		t.Fatalf("expected origin base.yml, got %q", p.Origin)
+	}
+	if len(cfg.LocalPackages()) != 1 {
+		t.Fatalf("expected 1 local package, got %+v", cfg.LocalPackages())
+	}
+	if len(cfg.IncludedTaps) != 1 || cfg.IncludedTaps[0] != "hashicorp/tap" {
+		t.Fatalf("unexpected included taps: %v", cfg.IncludedTaps)
+	}
+}
+
+func TestResolve_Remote_CachesAndRevalidates(t *testing.T) {
+	const url = "https://example.com/keg.yml"
+	f := &fakeFetcher{
+		body: map[string]string{url: "packages:\n  - command: jq\n"},
+		etag: `"v1"`,
+	}
+	r := newTestResolver(t, f)
+
+	resolve := func() *models.Config {
+		t.Helper()
+		cfg := models.Config{Include: []models.Include{{URL: url}}}
+		if err := r.Resolve(context.Background(), &cfg, filepath.Join(t.TempDir(), "keg.yml")); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		return &cfg
+	}
+
+	if cfg := resolve(); len(cfg.Packages) != 1 || cfg.Packages[0].Origin != url {
+		t.Fatalf("unexpected packages: %+v", cfg.Packages)
+	}
+
+	// Fresh cache: no network call
+	resolve()
+	if len(f.calls) != 1 {
+		t.Fatalf("expected cached copy within TTL, got %d calls", len(f.calls))
+	}
+
+	// Expired cache: conditional request answered with 304
+	r.TTL = 0
+	if cfg := resolve(); len(cfg.Packages) != 1 {
+		t.Fatalf("expected cached packages after 304, got %+v", cfg.Packages)
+	}
+	if len(f.calls) != 2 || f.calls[1] != `"v1"` {
+		t.Fatalf("expected revalidation with ETag, got %v", f.calls)
+	}
+
+	// Network down: fall back to the cached copy
+	f.err = errors.New("offline")
+	if cfg := resolve(); len(cfg.Packages) != 1 {
+		t.Fatalf("expected cached packages when offline, got %+v", cfg.Packages)
+	}
+}
+
+func TestResolve_RejectsInsecureURL(t *testing.T) {
+	cfg := models.Config{Include: []models.Include{{URL: "http://example.com/keg.yml"}}}
+	r := newTestResolver(t, &fakeFetcher{})
+	if err := r.Resolve(context.Background(), &cfg, "keg.yml"); err == nil {
+		t.Fatal("expected error for non-https include")
+	}
+}
+
+func TestResolve_ChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "base.yml"), "packages:\n  - command: fd\n")
+
+	cfg := models.Config{Include: []models.Include{{Path: "base.yml", SHA256: strings.Repeat("0", 64)}}}
+	r := newTestResolver(t, &fakeFetcher{})
+	err := r.Resolve(context.Background(), &cfg, filepath.Join(dir, "keg.yml"))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestResolve_Cycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yml"), "include: [b.yml]\n")
+	writeFile(t, filepath.Join(dir, "b.yml"), "include: [a.yml]\n")
+
+	cfg := models.Config{Include: []models.Include{{Path: "a.yml"}}}
+	r := newTestResolver(t, &fakeFetcher{})
+	err := r.Resolve(context.Background(), &cfg, filepath.Join(dir, "keg.yml"))
+	if !errors.Is(err, ErrIncludeCycle) {
+		t.Fatalf("expected ErrIncludeCycle, got %v", err)
+	}
+}
+
+func TestResolve_CommandsNeedPinnedInclude(t *testing.T) {
+	const url = "https://example.com/keg.yml"
+	body := `
+packages:
+  - command: rust
+    args: [--build-from-source]
+    env:
+      HOMEBREW_NO_INSTALL_FROM_API: "1"
+    hooks:
+      post_install: rustup-init -y
+    links:
+      - source: cargo.toml
+        target: .cargo/config.toml
+`
+	tests := []struct {
+		name   string
+		sha256 string
+		kept   bool
+	}{
+		{name: "unpinned", sha256: "", kept: false},
+		{name: "pinned", sha256: sha256Hex([]byte(body)), kept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := models.Config{Include: []models.Include{{URL: url, SHA256: tt.sha256}}}
+			r := newTestResolver(t, &fakeFetcher{body: map[string]string{url: body}, etag: `"v1"`})
+			if err := r.Resolve(context.Background(), &cfg, "keg.yml"); err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			p := byName(&cfg)["rust"]
+			for field, got := range map[string]bool{
+				"hooks": p.Hooks != nil,
+				"args":  len(p.Args) > 0,
+				"env":   len(p.Env) > 0,
+				"links": len(p.Links) > 0,
+			} {
+				if got != tt.kept {
+					t.Errorf("%s kept: got %v, want %v (%+v)", field, got, tt.kept, p)
+				}
+			}
+		})
+	}
+}
+
+func TestResolve_LocalIncludesKeepHooks(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "base.yml"), "packages:\n  - command: rust\n    hooks:\n      post_install: rustup-init -y\n")
+
+	cfg := models.Config{Include: []models.Include{{Path: "base.yml"}}}
+	r := newTestResolver(t, &fakeFetcher{})
+	if err := r.Resolve(context.Background(), &cfg, filepath.Join(dir, "keg.yml")); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if byName(&cfg)["rust"].Hooks == nil {
+		t.Fatal("a local include is trusted like keg.yml")
+	}
+}
+
+func TestResolve_Offline(t *testing.T) {
+	const url = "https://example.com/keg.yml"
+	body := "packages:\n  - command: zoxide\n    init: eval \"$(zoxide init zsh)\"\n"
+	f := &fakeFetcher{body: map[string]string{url: body}, etag: `"v1"`}
+	r := newTestResolver(t, f)
+	r.Offline = true
+	pinned := []models.Include{{URL: url, SHA256: sha256Hex([]byte(body))}}
+
+	cfg := models.Config{Include: pinned}
+	if err := r.Resolve(context.Background(), &cfg, "keg.yml"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(cfg.Packages) != 0 || len(f.calls) != 0 {
+		t.Fatalf("an include never fetched is skipped offline, got %+v after %d fetches", cfg.Packages, len(f.calls))
+	}
+
+	r.Offline = false
+	if err := r.Resolve(context.Background(), &models.Config{Include: pinned}, "keg.yml"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	// Past the TTL, offline still uses the cached copy
+	r.Offline, r.TTL = true, 0
+	cfg = models.Config{Include: pinned}
+	if err := r.Resolve(context.Background(), &cfg, "keg.yml"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if p := byName(&cfg)["zoxide"]; p.Init == nil || len(f.calls) != 1 {
+		t.Fatalf("expected the cached copy with its init, got %+v after %d fetches", p, len(f.calls))
+	}
+}
+
+func TestResolve_InitNeedsPinnedInclude(t *testing.T) {
+	const url = "https://example.com/keg.yml"
+	body := "packages:\n  - command: zoxide\n    init: eval \"$(zoxide init zsh)\"\n"
+	cfg := models.Config{Include: []models.Include{{URL: url}}}
+	r := newTestResolver(t, &fakeFetcher{body: map[string]string{url: body}, etag: `"v1"`})
+	if err := r.Resolve(context.Background(), &cfg, "keg.yml"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if p := byName(&cfg)["zoxide"]; p.Init != nil {
+		t.Fatalf("init of an unpinned include must be dropped, got %+v", p.Init)
+	}
+}
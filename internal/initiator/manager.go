@@ -38,14 +38,20 @@ func (*Initiator) Execute() error {
 		return fmt.Errorf("failed to ensure update state file exists: %w", err)
 	}
 
-	cfg := &globalconfig.PersistentConfig{
-		PackagesFile: pkgFile,
+	// Keep the profiles already configured, only the default manifest moves
+	cfg, err := globalconfig.ReadPersistentConfig()
+	if err != nil {
+		return err
 	}
+	cfg.PackagesFile = pkgFile
 
 	err = cfg.Save()
 	if err != nil {
 		return err
 	}
 
+	if cfg.ActiveProfile != "" {
+		logger.Info("Profile %s is active, run 'keg profile use %s' to use this keg.yml", cfg.ActiveProfile, globalconfig.DefaultProfile)
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"github.com/MrSnakeDoc/keg/internal/core"
 	"github.com/MrSnakeDoc/keg/internal/errs"
 	"github.com/MrSnakeDoc/keg/internal/install"
 	"github.com/MrSnakeDoc/keg/internal/middleware"
@@ -19,7 +20,12 @@ func NewInstallCmd() *cobra.Command {
 Examples:
     keg install              # Installs only non-optional packages
     keg install lazygit asdf # Installs base packages + lazygit and asdf
-    keg install --all        # Installs all packages, including optional ones`,
+    keg install --all        # Installs all packages, including optional ones
+    keg install --group k8s  # Installs every package of the k8s group, including optional ones
+    keg install kubectx --add --group k8s # Installs kubectx and adds it to the k8s group
+    keg install --frozen     # Fails instead of installing versions that differ from keg.lock
+    keg install --atomic     # Uninstalls what it installed if a package fails`,
+		Annotations: dryRunnable,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
 			if err != nil {
@@ -43,13 +49,34 @@ Examples:
 			if err != nil {
 				return err
 			}
+			groupFlag, err := cmd.Flags().GetStringSlice("group")
+			if err != nil {
+				return err
+			}
+
+			frozenFlag, err := cmd.Flags().GetBool("frozen")
+			if err != nil {
+				return err
+			}
 
-			err = validateFlags(allFlag, addFlag, optFlag, binaryFlag, args)
+			err = validateFlags(allFlag, addFlag, optFlag, binaryFlag, groupFlag, args)
 			if err != nil {
 				return err
 			}
+			if frozenFlag && addFlag {
+				return middleware.FlagComboError(errs.FrozenWithAdd)
+			}
+			atomicFlag, err := cmd.Flags().GetBool("atomic")
+			if err != nil {
+				return err
+			}
+			if atomicFlag && core.FlagKeepGoing {
+				return middleware.FlagComboError(errs.AtomicWithKeepGoing, "install")
+			}
 
-			return install.New(cfg, nil).Execute(args, allFlag, addFlag, optFlag, binaryFlag)
+			inst := install.New(cfg, nil)
+			inst.Atomic = atomicFlag
+			return inst.Execute(args, allFlag, addFlag, optFlag, binaryFlag, groupFlag, frozenFlag)
 		},
 	}
 
@@ -58,15 +85,24 @@ Examples:
 	cmd.Flags().BoolP("add", "A", false, "Add specified package to the configuration if not present and install it")
 	cmd.Flags().BoolP("optional", "o", false, "Mark added package as optional in the configuration (requires --add)")
 	cmd.Flags().StringP("binary", "b", "", "Specify the binary name if it differs from the package name (requires --add)")
+	cmd.Flags().StringSliceP("group", "g", nil, "Install the packages of these groups, or tag added packages with them (with --add)")
+	cmd.Flags().Bool("frozen", false, "Fail if the installed packages would differ from keg.lock")
+	cmd.Flags().Bool("atomic", false, "Roll back what this run installed and added if a package fails, without asking")
 
 	return cmd
 }
 
-func validateFlags(all, add, opt bool, binary string, args []string) error {
+func validateFlags(all, add, opt bool, binary string, groups []string, args []string) error {
 	// Validate flag combinations
 	if all && len(args) > 0 {
 		return middleware.FlagComboError(errs.AllWithNamedPackages, "Install", "install", "")
 	}
+	if all && len(groups) > 0 {
+		return middleware.FlagComboError(errs.AllWithGroup, "Install", "install")
+	}
+	if len(groups) > 0 && len(args) > 0 && !add {
+		return middleware.FlagComboError(errs.GroupNeedsAddWithArgs)
+	}
 	if all && add {
 		return middleware.FlagComboError(errs.AllWithAddInvalid)
 	}
@@ -1,8 +1,13 @@
 package install
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/MrSnakeDoc/keg/internal/lock"
 	"github.com/MrSnakeDoc/keg/internal/models"
 	"github.com/MrSnakeDoc/keg/internal/runner"
 )
@@ -15,6 +20,7 @@ var executeTestCases = []struct {
 	add           bool
 	optional      bool
 	binary        string
+	groups        []string
 	expectedError string
 }{
 	{
@@ -51,12 +57,28 @@ var executeTestCases = []struct {
 		add:    true,
 		binary: "bin8",
 	},
+	{
+		name:   "Install a group",
+		groups: []string{"k8s"},
+	},
+	{
+		name:   "Add new package to a group",
+		args:   []string{"pkg9"},
+		add:    true,
+		groups: []string{"k8s"},
+	},
+	{
+		name:          "Install unknown group",
+		groups:        []string{"nope"},
+		expectedError: "no package in configuration belongs to group: nope",
+	},
 }
 
 func TestInstaller_Execute(t *testing.T) {
-	oldSave := saveConfig
+	oldSave, oldPath := saveConfig, manifestPath
 	saveConfig = func(_ *models.Config) error { return nil }
-	defer func() { saveConfig = oldSave }()
+	manifestPath = func() (string, error) { return writeManifest(t, "packages: []\n"), nil }
+	defer func() { saveConfig, manifestPath = oldSave, oldPath }()
 	for _, tt := range executeTestCases {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRunner := runner.NewMockRunner()
@@ -66,13 +88,13 @@ func TestInstaller_Execute(t *testing.T) {
 				Packages: []models.Package{
 					{Command: "pkg1"},
 					{Command: "pkg2"},
-					{Command: "pkg3", Optional: true},
+					{Command: "pkg3", Optional: true, Groups: []string{"k8s"}},
 				},
 			}
 
 			installer := New(config, mockRunner)
 
-			err := installer.Execute(tt.args, tt.all, tt.add, tt.optional, tt.binary)
+			err := installer.Execute(tt.args, tt.all, tt.add, tt.optional, tt.binary, tt.groups, false)
 
 			if tt.expectedError != "" {
 				if err == nil {
@@ -90,3 +112,148 @@ func TestInstaller_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestInstaller_Execute_Frozen(t *testing.T) {
+	oldLoad := loadLock
+	defer func() { loadLock = oldLoad }()
+
+	info := []byte(`{"formulae": [
+		{"name": "pkg1", "full_name": "pkg1", "versions": {"stable": "1.1.0"}, "installed": [{"version": "1.0.0"}]},
+		{"name": "pkg2", "full_name": "pkg2", "versions": {"stable": "2.0.0"}, "installed": []}
+	]}`)
+
+	tests := []struct {
+		name        string
+		locked      []lock.Entry
+		wantErr     bool
+		wantInstall bool
+	}{
+		{
+			name: "matches lock",
+			locked: []lock.Entry{
+				{Name: "pkg1", Version: "1.0.0"},
+				{Name: "pkg2", Version: "2.0.0"},
+			},
+			wantInstall: true,
+		},
+		{
+			name: "installed version differs",
+			locked: []lock.Entry{
+				{Name: "pkg1", Version: "0.9.0"},
+				{Name: "pkg2", Version: "2.0.0"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "package missing from lock",
+			locked:  []lock.Entry{{Name: "pkg1", Version: "1.0.0"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadLock = func() (*lock.File, error) {
+				return &lock.File{Schema: lock.SchemaVersion, Packages: tt.locked}, nil
+			}
+
+			mockRunner := runner.NewMockRunner()
+			mockRunner.GetBrewList("pkg1")
+			mockRunner.AddResponse("brew|list|--formula|-1", []byte("pkg1\n"), nil)
+			mockRunner.AddResponse("brew|info|--json=v2|pkg1|pkg2", info, nil)
+
+			config := &models.Config{Packages: []models.Package{{Command: "pkg1"}, {Command: "pkg2"}}}
+			err := New(config, mockRunner).Execute(nil, false, false, false, "", nil, true)
+
+			if tt.wantErr {
+				if !errors.Is(err, lock.ErrDiverged) {
+					t.Fatalf("expected ErrDiverged, got %v", err)
+				}
+				if mockRunner.VerifyCommand("brew", "install", "pkg2") {
+					t.Fatalf("nothing must be installed when diverging from the lock")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantInstall && !mockRunner.VerifyCommand("brew", "install", "pkg2") {
+				t.Fatalf("expected brew install pkg2, got %+v", mockRunner.Commands)
+			}
+		})
+	}
+}
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keg.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type answer bool
+
+func (a answer) Confirm(string) (bool, error) { return bool(a), nil }
+func (answer) Prompt(string) (string, error)  { return "", nil }
+
+func TestInstaller_Execute_Rollback(t *testing.T) {
+	tests := []struct {
+		name     string
+		atomic   bool
+		confirm  bool
+		rollback bool
+	}{
+		{name: "atomic", atomic: true, rollback: true},
+		{name: "confirmed", confirm: true, rollback: true},
+		{name: "declined", confirm: false, rollback: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			path := writeManifest(t, "packages:\n  - command: pkg1\n")
+			oldSave, oldPath := saveConfig, manifestPath
+			saveConfig = func(_ *models.Config) error { return os.WriteFile(path, []byte("edited\n"), 0o644) }
+			manifestPath = func() (string, error) { return path, nil }
+			defer func() { saveConfig, manifestPath = oldSave, oldPath }()
+
+			mockRunner := runner.NewMockRunner()
+			// brew lists pkg2 once the run installed it
+			mockRunner.ResponseFunc = func(name string, args ...string) ([]byte, error) {
+				if name == "brew" && strings.Join(args, " ") == "list --formula -1" {
+					if mockRunner.VerifyCommand("brew", "install", "pkg2") {
+						return []byte("pkg1\npkg2\n"), nil
+					}
+					return []byte("pkg1\n"), nil
+				}
+				return []byte{}, nil
+			}
+			mockRunner.AddResponse("brew|install|pkg2|pkg3", nil, errors.New("exit status 1"))
+			mockRunner.AddResponse("brew|install|pkg3", nil, errors.New("exit status 1"))
+
+			installer := New(&models.Config{Packages: []models.Package{{Command: "pkg1"}}}, mockRunner)
+			installer.Atomic = tt.atomic
+			installer.Prompter = answer(tt.confirm)
+
+			err := installer.Execute([]string{"pkg2", "pkg3"}, false, true, false, "", nil, false)
+			if err == nil {
+				t.Fatal("expected the pkg3 failure")
+			}
+			if got := mockRunner.VerifyCommand("brew", "uninstall", "pkg2"); got != tt.rollback {
+				t.Errorf("pkg2 uninstalled: got %v, want %v", got, tt.rollback)
+			}
+			if mockRunner.VerifyCommand("brew", "uninstall", "pkg1") {
+				t.Error("pkg1 was there before the run")
+			}
+			data, _ := os.ReadFile(path)
+			if restored := string(data) == "packages:\n  - command: pkg1\n"; restored != tt.rollback {
+				t.Errorf("keg.yml restored: got %v, want %v (%q)", restored, tt.rollback, data)
+			}
+			if installer.Journal().Empty() != tt.rollback {
+				t.Errorf("the journal is emptied by a rollback only")
+			}
+		})
+	}
+}
@@ -1,39 +1,65 @@
 package install
 
 import (
+	"context"
+	"fmt"
+	"os"
+
 	"github.com/MrSnakeDoc/keg/internal/core"
 	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/lock"
 	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/MrSnakeDoc/keg/internal/manifest"
 	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/prompter"
 	"github.com/MrSnakeDoc/keg/internal/runner"
 )
 
 type Installer struct {
 	*core.Base
+	// Atomic rolls back a failed run without asking Prompter first; without
+	// either, a failed run is left as it is.
+	Atomic   bool
+	Prompter prompter.Prompter
 }
 
-var saveConfig = globalconfig.SaveConfig
+var (
+	saveConfig   = globalconfig.SaveConfig
+	manifestPath = globalconfig.ManifestPath
+	loadLock     = lock.Load
+)
 
 func New(config *models.Config, r runner.CommandRunner) *Installer {
 	if r == nil {
-		r = &runner.ExecRunner{}
+		r = runner.New()
 	}
 
 	return &Installer{
-		Base: core.NewBase(config, r),
+		Base:     core.NewBase(config, r),
+		Prompter: prompter.New(os.Stdin, os.Stdout),
 	}
 }
 
-func (i *Installer) Execute(args []string, all bool, add bool, optional bool, binary string) error {
+// Execute installs the selected packages, adding them to keg.yml first with
+// add. When it fails partway, what it installed and the keg.yml edits can be
+// rolled back (see core.Base.RollbackAfter).
+func (i *Installer) Execute(args []string, all bool, add bool, optional bool, binary string, groups []string, frozen bool) error {
+	err := i.execute(args, all, add, optional, binary, groups, frozen)
+	return i.RollbackAfter(err, i.Atomic, i.Prompter)
+}
+
+func (i *Installer) execute(args []string, all bool, add bool, optional bool, binary string, groups []string, frozen bool) error {
 	// 2) Optionally update manifest first
 	if add {
 		// manifest.AddPackages mutates cfg in-memory
-		modified, err := manifest.AddPackages(i.Config, i.FindPackage, args, binary, optional)
+		modified, err := manifest.AddPackages(i.Config, i.FindPackage, args, binary, optional, groups)
 		if err != nil {
 			return err
 		}
 		if modified {
+			if err := i.backupManifest(); err != nil {
+				return err
+			}
 			if err := saveConfig(i.Config); err != nil {
 				return err
 			}
@@ -42,6 +68,39 @@ func (i *Installer) Execute(args []string, all bool, add bool, optional bool, bi
 	}
 
 	// 3) Build opts and run
+	opts, err := i.handlerOptions(args, all, groups)
+	if err != nil {
+		return err
+	}
+	if frozen {
+		if err := i.checkFrozen(opts); err != nil {
+			return err
+		}
+	}
+	err = i.HandlePackages(opts)
+	if err != nil && !i.KeepGoing {
+		return err
+	}
+
+	// Top-level links belong to no package: a full install sets them up
+	if len(args) == 0 && len(groups) == 0 && len(i.Config.Links) > 0 {
+		i.Links.Apply("", i.Config.Links, false)
+	}
+	return err
+}
+
+// backupManifest records keg.yml in the journal before --add edits it.
+func (i *Installer) backupManifest() error {
+	path, err := manifestPath()
+	if err != nil {
+		return err
+	}
+	return i.Journal().RecordManifest(path)
+}
+
+// handlerOptions selects the packages to install: the named ones, the
+// members of groups, every package with all, else the non-optional ones.
+func (i *Installer) handlerOptions(args []string, all bool, groups []string) (core.PackageHandlerOptions, error) {
 	opts := core.DefaultPackageHandlerOptions(core.PackageAction{
 		Name:        "Installing",
 		ActionVerb:  "install",
@@ -53,5 +112,35 @@ func (i *Installer) Execute(args []string, all bool, add bool, optional bool, bi
 	if all {
 		opts.FilterFunc = func(_ *models.Package) bool { return true }
 	}
-	return i.HandlePackages(opts)
+	if len(groups) > 0 && len(args) == 0 {
+		if err := core.ValidateGroups(i.Config, groups); err != nil {
+			return opts, err
+		}
+		opts.FilterFunc = core.GroupFilter(groups)
+	}
+	return opts, nil
+}
+
+// checkFrozen refuses to install anything when the selected packages would
+// not end up at the versions recorded in keg.lock.
+func (i *Installer) checkFrozen(opts core.PackageHandlerOptions) error {
+	lf, err := loadLock()
+	if err != nil {
+		return err
+	}
+	pkgs, err := i.SelectPackages(opts)
+	if err != nil {
+		return err
+	}
+	drifts, err := lock.Verify(context.Background(), i.Runner, lf, pkgs, false)
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		return nil
+	}
+	if err := lock.RenderDrifts(drifts); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w (%d packages); run 'keg lock --update' to accept the changes", lock.ErrDiverged, len(drifts))
 }
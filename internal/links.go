@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/links"
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/models"
+
+	"github.com/spf13/cobra"
+)
+
+func NewLinksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "links",
+		Short: "Manage the dotfiles linked by keg.yml",
+		Long: `Manage the config files keg.yml links from a dotfiles directory.
+
+Links are applied when their package is installed; top-level links when
+'keg install' runs for the whole manifest. Files already at a target are
+never replaced unless --force is given to 'keg links apply'.`,
+	}
+	cmd.AddCommand(middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.LoadPkgList)(newLinksStatusCmd)())
+	cmd.AddCommand(middleware.UseMiddlewareChain(middleware.RequireConfig, middleware.IsHomebrewInstalled, middleware.LoadPkgList)(newLinksApplyCmd)())
+	return cmd
+}
+
+func newLinksStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show which links are in place",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			return links.New(cfg, nil).Status()
+		},
+	}
+}
+
+func newLinksApplyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Create the missing links of installed packages",
+		Long: `Create the top-level links of keg.yml and the links of installed packages.
+
+Examples:
+  keg links apply            # Create missing links, report conflicts
+  keg links apply --force    # Back up conflicting files (*.keg-backup) and link`,
+		Args:        cobra.NoArgs,
+		Annotations: dryRunnable,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			force, err := cmd.Flags().GetBool("force")
+			if err != nil {
+				return err
+			}
+
+			return links.New(cfg, nil).Apply(force)
+		},
+	}
+
+	cmd.Flags().BoolP("force", "f", false, "Back up files in the way of a link and replace them")
+	return cmd
+}
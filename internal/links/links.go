@@ -0,0 +1,263 @@
+package links
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/plan"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+	"github.com/MrSnakeDoc/keg/internal/utils/pathutils"
+)
+
+// BackupSuffix is appended to files moved out of the way of a link.
+const BackupSuffix = ".keg-backup"
+
+type Status string
+
+const (
+	StatusLinked   Status = "linked"
+	StatusMissing  Status = "missing"
+	StatusConflict Status = "conflict"
+	StatusNoSource Status = "source missing"
+)
+
+var ErrConflict = errors.New("target already exists")
+
+// State is a link resolved against the file system.
+type State struct {
+	Link models.Link
+	// Package owning the link, empty for the top-level links of keg.yml.
+	Package string
+	Source  string
+	Target  string
+	Status  Status
+}
+
+type Linker struct {
+	Config *models.Config
+	// Dir is the dotfiles directory; defaults to `dotfiles:` of keg.yml,
+	// resolved next to keg.yml.
+	Dir string
+	// DryRun records the links to the plan instead of creating them.
+	DryRun bool
+}
+
+func NewLinker(config *models.Config) *Linker {
+	return &Linker{Config: config, DryRun: runner.FlagDryRun}
+}
+
+// dir returns the dotfiles directory, resolving it on first use since it
+// depends on where keg.yml lives.
+func (l *Linker) dir() (string, error) {
+	if l.Dir != "" {
+		return l.Dir, nil
+	}
+
+	dir := l.Config.Dotfiles
+	if strings.HasPrefix(dir, "~") {
+		abs, err := pathutils.ToAbsolutePath(dir)
+		if err != nil {
+			return "", err
+		}
+		dir = abs
+	}
+	if !filepath.IsAbs(dir) {
+		cfg, err := globalconfig.LoadPersistentConfig()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate the dotfiles directory: %w", err)
+		}
+		dir = filepath.Join(filepath.Dir(cfg.Manifest()), dir)
+	}
+	l.Dir = filepath.Clean(dir)
+	return l.Dir, nil
+}
+
+// Resolve returns the absolute source and target of link. Sources must stay
+// inside the dotfiles directory, so an included manifest cannot link
+// arbitrary files.
+func (l *Linker) Resolve(link models.Link) (string, string, error) {
+	if link.Source == "" || link.Target == "" {
+		return "", "", errors.New("links need a source and a target")
+	}
+
+	dir, err := l.dir()
+	if err != nil {
+		return "", "", err
+	}
+	source := filepath.Join(dir, link.Source)
+	if rel, err := filepath.Rel(dir, source); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", "", fmt.Errorf("source %s is outside of %s", link.Source, dir)
+	}
+
+	target := link.Target
+	switch {
+	case strings.HasPrefix(target, "~"):
+		if target, err = pathutils.ToAbsolutePath(target); err != nil {
+			return "", "", err
+		}
+	case !filepath.IsAbs(target):
+		target = filepath.Join(utils.GetHomeDir(), target)
+	}
+	return source, filepath.Clean(target), nil
+}
+
+// Check resolves link and compares its target with its source.
+func (l *Linker) Check(pkg string, link models.Link) (State, error) {
+	s := State{Link: link, Package: pkg}
+	var err error
+	if s.Source, s.Target, err = l.Resolve(link); err != nil {
+		return s, err
+	}
+
+	src, err := os.Stat(s.Source)
+	if err != nil {
+		s.Status = StatusNoSource
+		return s, nil
+	}
+	if _, err := os.Lstat(s.Target); err != nil {
+		s.Status = StatusMissing
+		return s, nil
+	}
+
+	s.Status = StatusConflict
+	if link.Copy {
+		if !src.IsDir() && sameContent(s.Source, s.Target) {
+			s.Status = StatusLinked
+		}
+	} else if dest, err := os.Readlink(s.Target); err == nil && dest == s.Source {
+		s.Status = StatusLinked
+	}
+	return s, nil
+}
+
+// Apply links every entry of links, reporting each outcome. Targets that
+// exist are left alone unless force is set, in which case they are moved
+// aside (see BackupSuffix) first. It returns the number of links that could
+// not be applied.
+func (l *Linker) Apply(pkg string, links []models.Link, force bool) int {
+	failed := 0
+	for _, link := range links {
+		s, err := l.Check(pkg, link)
+		if err == nil {
+			err = l.apply(s, force)
+		}
+		if err != nil {
+			logger.Warn("Link %s: %v", link.Target, err)
+			failed++
+		}
+	}
+	return failed
+}
+
+func (l *Linker) apply(s State, force bool) error {
+	switch s.Status {
+	case StatusLinked:
+		logger.Debug("%s is already linked", s.Target)
+		return nil
+	case StatusNoSource:
+		return fmt.Errorf("source %s does not exist", s.Source)
+	case StatusConflict:
+		if !force {
+			return fmt.Errorf("%w, run 'keg links apply --force' to back it up and replace it", ErrConflict)
+		}
+	}
+
+	if l.DryRun {
+		record(s)
+		return nil
+	}
+
+	if s.Status == StatusConflict {
+		backup, err := backupFile(s.Target)
+		if err != nil {
+			return err
+		}
+		logger.Info("Moved %s to %s", s.Target, backup)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Target), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(s.Target), err)
+	}
+	if s.Link.Copy {
+		if err := copyFile(s.Source, s.Target); err != nil {
+			return err
+		}
+		logger.Success("Copied %s to %s", s.Source, s.Target)
+		return nil
+	}
+	if err := os.Symlink(s.Source, s.Target); err != nil {
+		return fmt.Errorf("failed to link %s: %w", s.Target, err)
+	}
+	logger.Success("Linked %s -> %s", s.Target, s.Source)
+	return nil
+}
+
+// record adds the link apply would create to the plan of a --dry-run run.
+func record(s State) {
+	detail := s.Source
+	if s.Link.Copy {
+		detail = "copy of " + detail
+	}
+	if s.Status == StatusConflict {
+		detail += ", existing file backed up"
+	}
+	plan.Record(plan.Change{Action: plan.Link, Name: s.Target, Detail: detail})
+}
+
+// backupFile moves path to path.keg-backup, adding a timestamp when an
+// older backup is in the way.
+func backupFile(path string) (string, error) {
+	backup := path + BackupSuffix
+	if _, err := os.Lstat(backup); err == nil {
+		backup += "-" + time.Now().Format("20060102-150405")
+	}
+	if err := os.Rename(path, backup); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return backup, nil
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot copy directory %s, link it instead", src)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer func() { _ = in.Close() }()
+
+	if err := utils.WriteFileAtomic(dst+".tmp", dst, in); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return os.Chmod(dst, info.Mode().Perm())
+}
+
+func sameContent(a, b string) bool {
+	da, err := os.ReadFile(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = fb.Close() }()
+	db, err := io.ReadAll(io.LimitReader(fb, int64(len(da))+1))
+	return err == nil && bytes.Equal(da, db)
+}
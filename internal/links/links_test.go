@@ -0,0 +1,147 @@
+package links
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+// newTestLinker returns a linker over a dotfiles directory holding
+// lazygit/config.yml, with HOME pointing to an empty directory.
+func newTestLinker(t *testing.T) (*Linker, string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lazygit"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lazygit", "config.yml"), []byte("gui: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLinker(&models.Config{})
+	l.Dir = dir
+	return l, home
+}
+
+func TestApply_Symlink(t *testing.T) {
+	l, home := newTestLinker(t)
+	link := models.Link{Source: "lazygit/config.yml", Target: "~/.config/lazygit/config.yml"}
+
+	if failed := l.Apply("lazygit", []models.Link{link}, false); failed != 0 {
+		t.Fatalf("expected the link to be created, %d failed", failed)
+	}
+	target := filepath.Join(home, ".config", "lazygit", "config.yml")
+	if dest, err := os.Readlink(target); err != nil || dest != filepath.Join(l.Dir, "lazygit", "config.yml") {
+		t.Fatalf("unexpected link: %q, %v", dest, err)
+	}
+
+	s, err := l.Check("lazygit", link)
+	if err != nil || s.Status != StatusLinked {
+		t.Fatalf("expected linked, got %+v, %v", s, err)
+	}
+	// Applying again is a no-op
+	if failed := l.Apply("lazygit", []models.Link{link}, false); failed != 0 {
+		t.Fatalf("second apply failed")
+	}
+}
+
+func TestApply_Conflict(t *testing.T) {
+	l, home := newTestLinker(t)
+	link := models.Link{Source: "lazygit/config.yml", Target: ".config/lazygit/config.yml"}
+	target := filepath.Join(home, ".config", "lazygit", "config.yml")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("mine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, _ := l.Check("", link); s.Status != StatusConflict {
+		t.Fatalf("expected a conflict, got %s", s.Status)
+	}
+	if failed := l.Apply("", []models.Link{link}, false); failed != 1 {
+		t.Fatalf("expected the conflict to be reported")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "mine\n" {
+		t.Fatalf("existing file must be left alone without force, got %q", data)
+	}
+
+	if failed := l.Apply("", []models.Link{link}, true); failed != 0 {
+		t.Fatalf("force apply failed")
+	}
+	if data, _ := os.ReadFile(target + BackupSuffix); string(data) != "mine\n" {
+		t.Fatalf("expected a backup of the existing file, got %q", data)
+	}
+	if s, _ := l.Check("", link); s.Status != StatusLinked {
+		t.Fatalf("expected linked after force, got %s", s.Status)
+	}
+}
+
+func TestApply_Copy(t *testing.T) {
+	l, home := newTestLinker(t)
+	link := models.Link{Source: "lazygit/config.yml", Target: "~/lg.yml", Copy: true}
+
+	if failed := l.Apply("", []models.Link{link}, false); failed != 0 {
+		t.Fatalf("copy failed")
+	}
+	target := filepath.Join(home, "lg.yml")
+	if info, err := os.Lstat(target); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("expected a regular file, got %v, %v", info, err)
+	}
+	if s, _ := l.Check("", link); s.Status != StatusLinked {
+		t.Fatalf("identical copy must count as linked, got %s", s.Status)
+	}
+
+	if err := os.WriteFile(target, []byte("edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := l.Check("", link); s.Status != StatusConflict {
+		t.Fatalf("edited copy must be a conflict, got %s", s.Status)
+	}
+}
+
+func TestResolve_RejectsEscapingSource(t *testing.T) {
+	l, _ := newTestLinker(t)
+	if _, _, err := l.Resolve(models.Link{Source: "../secret", Target: "~/x"}); err == nil {
+		t.Fatal("expected an error for a source outside of the dotfiles directory")
+	}
+	if s, _ := l.Check("", models.Link{Source: "nope", Target: "~/x"}); s.Status != StatusNoSource {
+		t.Fatalf("expected source missing, got %s", s.Status)
+	}
+}
+
+func TestManagerApply_SkipsMissingPackages(t *testing.T) {
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|list|--formula|-1", []byte("bat\n"), nil)
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "bat", Links: []models.Link{{Source: "lazygit/config.yml", Target: "~/bat.yml"}}},
+		{Command: "lazygit", Links: []models.Link{{Source: "lazygit/config.yml", Target: "~/lazygit.yml"}}},
+	}}
+	m := New(cfg, mr)
+	l, home := newTestLinker(t)
+	m.Dir = l.Dir
+	m.Host = &models.Host{OS: "linux", Arch: "amd64"}
+
+	if err := m.Apply(false); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(home, "bat.yml")); err != nil {
+		t.Fatalf("expected bat's link: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(home, "lazygit.yml")); !os.IsNotExist(err) {
+		t.Fatalf("links of packages that are not installed must be skipped, got %v", err)
+	}
+}
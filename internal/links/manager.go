@@ -0,0 +1,112 @@
+package links
+
+import (
+	"fmt"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/printer"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+type Manager struct {
+	*Linker
+	Runner runner.CommandRunner
+	Host   *models.Host
+}
+
+func New(config *models.Config, r runner.CommandRunner) *Manager {
+	if r == nil {
+		r = runner.New()
+	}
+	return &Manager{
+		Linker: NewLinker(config),
+		Runner: r,
+		Host:   utils.CurrentHost(),
+	}
+}
+
+// Status shows every link of keg.yml (top-level ones, then the ones of
+// the packages available on this host) and whether it is in place.
+func (m *Manager) Status() error {
+	var states []State
+	m.each(func(pkg string, links []models.Link) {
+		for _, link := range links {
+			s, err := m.Check(pkg, link)
+			if err != nil {
+				logger.Warn("Link %s: %v", link.Target, err)
+				continue
+			}
+			states = append(states, s)
+		}
+	})
+	if len(states) == 0 {
+		logger.Info("No links in keg.yml")
+		return nil
+	}
+	return render(states)
+}
+
+// Apply puts the top-level links and the links of installed packages in
+// place. With force, files in the way are backed up and replaced.
+func (m *Manager) Apply(force bool) error {
+	installed, err := utils.InstalledSet(m.Runner)
+	if err != nil {
+		return fmt.Errorf("fetch installed packages: %w", err)
+	}
+
+	failed := 0
+	m.each(func(pkg string, links []models.Link) {
+		if pkg != "" && !installed[pkg] {
+			logger.Info("Skipping links of %s: package not installed", pkg)
+			return
+		}
+		failed += m.Linker.Apply(pkg, links, force)
+	})
+	if failed > 0 {
+		return fmt.Errorf("%d link(s) could not be applied", failed)
+	}
+	return nil
+}
+
+// each calls fn with the top-level links, then with the links of each
+// package available on this host.
+func (m *Manager) each(fn func(pkg string, links []models.Link)) {
+	if len(m.Config.Links) > 0 {
+		fn("", m.Config.Links)
+	}
+	for i := range m.Config.Packages {
+		p := &m.Config.Packages[i]
+		if len(p.Links) > 0 && p.AvailableOn(m.Host) {
+			fn(p.FormulaName(), p.Links)
+		}
+	}
+}
+
+func render(states []State) error {
+	p := printer.NewColorPrinter()
+	table := logger.CreateTable([]string{"Target", "Source", "Package", "Status"})
+	for _, s := range states {
+		pkg := s.Package
+		if pkg == "" {
+			pkg = "—"
+		}
+		status := string(s.Status)
+		switch s.Status {
+		case StatusLinked:
+			status = p.Success(status)
+		case StatusMissing:
+			status = p.Warning(status)
+		case StatusConflict, StatusNoSource:
+			status = p.Error(status)
+		}
+		if err := table.Append([]string{s.Link.Target, s.Link.Source, pkg, status}); err != nil {
+			return fmt.Errorf("append to table: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("render table: %w", err)
+	}
+	return nil
+}
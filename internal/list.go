@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"github.com/MrSnakeDoc/keg/internal/errs"
 	"github.com/MrSnakeDoc/keg/internal/list"
 	"github.com/MrSnakeDoc/keg/internal/middleware"
 	"github.com/MrSnakeDoc/keg/internal/models"
@@ -16,6 +17,8 @@ func NewListCmd() *cobra.Command {
 
 By default shows only packages from your config.
 With --deps/-d, shows extra packages that are installed but not configured.
+Those installed on their own are typed "leaf" (see 'keg adopt'), the others
+are dependencies of other packages and typed "dep".
 With --fzf/-f, outputs in tab-separated format (package ↦ version ↦ status ↦ type),
 ready to be piped into fzf or other tools.
 
@@ -31,6 +34,9 @@ Examples:
   keg list --fzf
   keg list -f
 
+  # Show only the packages of a group
+  keg list --group k8s
+
   # Combine: list deps in fzf mode
   keg list -d -f
 
@@ -47,10 +53,20 @@ Examples:
 				return err
 			}
 
-			return list.New(cfg, nil).Execute(cmd.Context(), onlyDeps)
+			groups, err := cmd.Flags().GetStringSlice("group")
+			if err != nil {
+				return err
+			}
+
+			if onlyDeps && len(groups) > 0 {
+				return middleware.FlagComboError(errs.DepsWithGroup)
+			}
+
+			return list.New(cfg, nil).Execute(cmd.Context(), onlyDeps, groups)
 		},
 	}
 
 	cmd.Flags().BoolP("deps", "d", false, "Show only non-config packages (deps/utils)")
+	cmd.Flags().StringSliceP("group", "g", nil, "Show only the packages of these groups")
 	return cmd
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/MrSnakeDoc/keg/internal/core"
 	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/MrSnakeDoc/keg/internal/models"
 	"github.com/MrSnakeDoc/keg/internal/printer"
@@ -14,16 +15,17 @@ import (
 
 // row is a view model for rendering.
 type row struct {
-	DisplayName string // what we show in the table (binary or command as today)
+	DisplayName string // what we show in the table (formula name)
 	Version     string
 	StatusCode  string
-	Type        string // "core" | "dep" | "optional"
+	Type        string // "core" | "leaf" | "dep" | "optional"
 	SortKey     string // ALWAYS the command name for sorting
 }
 
 type Lister struct {
 	Config *models.Config
 	Runner runner.CommandRunner
+	Host   *models.Host
 }
 
 func New(config *models.Config, r runner.CommandRunner) *Lister {
@@ -33,13 +35,21 @@ func New(config *models.Config, r runner.CommandRunner) *Lister {
 	return &Lister{
 		Config: config,
 		Runner: r,
+		Host:   utils.CurrentHost(),
 	}
 }
 
 // Execute renders the list table.
 // - onlyDeps=false => manifest only
 // - onlyDeps=true  => only deps/ad-hoc (installed but not in manifest)
-func (l *Lister) Execute(ctx context.Context, onlyDeps bool) error {
+// - groups         => restrict manifest rows to these groups
+func (l *Lister) Execute(ctx context.Context, onlyDeps bool, groups []string) error {
+	if len(groups) > 0 {
+		if err := core.ValidateGroups(l.Config, groups); err != nil {
+			return err
+		}
+	}
+
 	installed, err := utils.InstalledSet(l.Runner)
 	if err != nil {
 		return fmt.Errorf("fetch installed packages: %w", err)
@@ -47,12 +57,17 @@ func (l *Lister) Execute(ctx context.Context, onlyDeps bool) error {
 
 	// configured names + sets + map
 	configured, cfgSet, optionalSet, nameToCommand := l.buildConfigured()
+	binaries := l.binariesByName()
+	unavailable := l.unavailableOnHost()
 	deps := l.computeDeps(installed, cfgSet)
+	leaves := l.leaves(onlyDeps)
 
 	// choose list
 	names := configured
 	if onlyDeps {
 		names = deps
+	} else if len(groups) > 0 {
+		names = l.groupMembers(groups)
 	}
 
 	// versions
@@ -65,24 +80,14 @@ func (l *Lister) Execute(ctx context.Context, onlyDeps bool) error {
 
 	// Build rows
 	rows := utils.Map(names, func(name string) row {
-		status := "installed"
-		if !installed[name] {
-			status = "missing"
-		}
+		status := rowStatus(name, onlyDeps, installed, unavailable, binaries)
 
 		ver := "—"
 		if vi, ok := versionInfo[name]; ok && vi.Installed != "" {
 			ver = vi.Installed
 		}
 
-		pkgType := "dep"
-		if !onlyDeps {
-			if optionalSet[name] {
-				pkgType = "optional"
-			} else if _, ok := cfgSet[name]; ok {
-				pkgType = "core"
-			}
-		}
+		pkgType := rowType(name, onlyDeps, leaves, cfgSet, optionalSet)
 
 		// SortKey = command name when we know it; fallback to name
 		sortKey := name
@@ -99,12 +104,45 @@ func (l *Lister) Execute(ctx context.Context, onlyDeps bool) error {
 		}
 	})
 
-	// Sort rows: core < dep < optional, then alpha by command
+	// Sort rows: core < leaf < dep < optional, then alpha by command
 	utils.SortByTypeAndKey(rows, func(r row) string { return r.Type }, func(r row) string { return r.SortKey })
 
 	return outputItems(rows)
 }
 
+// rowStatus returns the status code of name. Host and binary checks only
+// apply to manifest rows.
+func rowStatus(name string, onlyDeps bool, installed, unavailable map[string]bool, binaries map[string]string) string {
+	if unavailable[name] && !onlyDeps {
+		return "unavailable"
+	}
+	if !installed[name] {
+		return "missing"
+	}
+	if bin := binaries[name]; bin != "" && !onlyDeps {
+		if _, ok := utils.ResolveBinary(bin); !ok {
+			return "binary_missing"
+		}
+	}
+	return "installed"
+}
+
+func rowType(name string, onlyDeps bool, leaves map[string]bool, cfgSet map[string]struct{}, optionalSet map[string]bool) string {
+	if onlyDeps {
+		if leaves[name] {
+			return "leaf"
+		}
+		return "dep"
+	}
+	if optionalSet[name] {
+		return "optional"
+	}
+	if _, ok := cfgSet[name]; ok {
+		return "core"
+	}
+	return "dep"
+}
+
 func outputItems(rows []row) error {
 	p := printer.NewColorPrinter()
 	table := logger.CreateTable([]string{"Package", "Version", "Status", "Type"})
@@ -116,6 +154,10 @@ func outputItems(rows []row) error {
 			status = p.Success("installed")
 		case "missing":
 			status = p.Warning("not installed")
+		case "binary_missing":
+			status = p.Error("binary missing")
+		case "unavailable":
+			status = p.Info("n/a on this host")
 		}
 
 		if err := logger.RenderRow(table, r.DisplayName, r.Version, status, prettyType(p, r.Type)); err != nil {
@@ -131,10 +173,7 @@ func outputItems(rows []row) error {
 
 func (l *Lister) buildConfigured() (names []string, cfgSet map[string]struct{}, optionalSet map[string]bool, nameToCommand map[string]string) {
 	names = utils.Map(l.Config.Packages, func(p models.Package) string {
-		if p.Binary != "" {
-			return p.Binary
-		}
-		return p.Command
+		return p.FormulaName()
 	})
 
 	cfgSet = make(map[string]struct{}, len(names))
@@ -142,10 +181,7 @@ func (l *Lister) buildConfigured() (names []string, cfgSet map[string]struct{},
 	nameToCommand = make(map[string]string, len(names))
 
 	for _, p := range l.Config.Packages {
-		name := p.Command
-		if p.Binary != "" {
-			name = p.Binary
-		}
+		name := p.FormulaName()
 		cfgSet[name] = struct{}{}
 		nameToCommand[name] = p.Command // <- ALWAYS store the command for sorting
 		if p.Optional {
@@ -155,6 +191,36 @@ func (l *Lister) buildConfigured() (names []string, cfgSet map[string]struct{},
 	return names, cfgSet, optionalSet, nameToCommand
 }
 
+// groupMembers returns the formula names of the packages in any of groups.
+func (l *Lister) groupMembers(groups []string) []string {
+	members := utils.Filter(l.Config.Packages, func(p models.Package) bool { return p.InAnyGroup(groups) })
+	return utils.Map(members, func(p models.Package) string { return p.FormulaName() })
+}
+
+// binariesByName maps formula names to the binary they declare, for packages
+// whose executable differs from the formula name.
+func (l *Lister) binariesByName() map[string]string {
+	out := make(map[string]string)
+	for _, p := range l.Config.Packages {
+		if p.Binary != "" {
+			out[p.FormulaName()] = p.Binary
+		}
+	}
+	return out
+}
+
+// unavailableOnHost returns the formula names whose `when:` block does not
+// match this host.
+func (l *Lister) unavailableOnHost() map[string]bool {
+	out := make(map[string]bool)
+	for i := range l.Config.Packages {
+		if p := &l.Config.Packages[i]; !p.AvailableOn(l.Host) {
+			out[p.FormulaName()] = true
+		}
+	}
+	return out
+}
+
 func (l *Lister) computeDeps(installed map[string]bool, cfgSet map[string]struct{}) []string {
 	return utils.Filter(utils.Keys(installed), func(n string) bool {
 		_, ok := cfgSet[n]
@@ -162,6 +228,24 @@ func (l *Lister) computeDeps(installed map[string]bool, cfgSet map[string]struct
 	})
 }
 
+// leaves returns the formula names of the installed packages nothing depends
+// on. They are only needed to tell leaves from dependencies in --deps mode.
+func (l *Lister) leaves(onlyDeps bool) map[string]bool {
+	out := make(map[string]bool)
+	if !onlyDeps {
+		return out
+	}
+	set, err := utils.LeavesSet(l.Runner)
+	if err != nil {
+		logger.Debug("leaves lookup failed (list): %v", err)
+		return out
+	}
+	for name := range set {
+		out[(&models.Package{Command: name}).FormulaName()] = true
+	}
+	return out
+}
+
 // prettyType colors only the UI label, not the sorting value.
 func prettyType(p *printer.ColorPrinter, t string) string {
 	switch t {
@@ -169,6 +253,8 @@ func prettyType(p *printer.ColorPrinter, t string) string {
 		return p.Warning("optional")
 	case "core":
 		return "core"
+	case "leaf":
+		return p.Info("leaf")
 	case "dep":
 		return "dep"
 	default:
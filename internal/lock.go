@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/lock"
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/models"
+
+	"github.com/spf13/cobra"
+)
+
+func NewLockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Record installed package versions in keg.lock",
+		Long: `Record the formula, tap, installed version and bottle checksum of every
+package from keg.yml in a keg.lock file next to it.
+
+Without --update, an existing keg.lock is compared with the installed
+packages and the differences are listed. Commit keg.lock and use
+'keg install --frozen' to reproduce the same environment elsewhere.
+
+Examples:
+  keg lock             # Create keg.lock, or show how this machine differs from it
+  keg lock --update    # Rewrite keg.lock from the installed packages`,
+		Annotations: dryRunnable,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			update, err := cmd.Flags().GetBool("update")
+			if err != nil {
+				return err
+			}
+
+			return lock.New(cfg, nil).Execute(cmd.Context(), update)
+		},
+	}
+
+	cmd.Flags().BoolP("update", "u", false, "Rewrite keg.lock from the installed packages")
+	return cmd
+}
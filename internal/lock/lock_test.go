@@ -0,0 +1,162 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/versions"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+const brewInfo = `{"formulae": [
+	{
+		"name": "ripgrep", "full_name": "ripgrep", "tap": "homebrew/core",
+		"versions": {"stable": "14.1.0"},
+		"installed": [{"version": "14.1.0"}],
+		"bottle": {"stable": {"files": {
+			"x86_64_linux": {"sha256": "aaa"},
+			"arm64_linux": {"sha256": "aaa"}
+		}}}
+	},
+	{
+		"name": "terraform", "full_name": "hashicorp/tap/terraform", "tap": "hashicorp/tap",
+		"versions": {"stable": "1.9.5"},
+		"installed": [{"version": "1.9.2"}],
+		"bottle": {"stable": {"files": {"all": {"sha256": "bbb"}}}}
+	},
+	{
+		"name": "jq", "full_name": "jq", "tap": "homebrew/core",
+		"versions": {"stable": "1.7.1"},
+		"installed": []
+	}
+]}`
+
+func newTestLocker(t *testing.T) *Locker {
+	t.Helper()
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|info|--json=v2|hashicorp/tap/terraform|jq|ripgrep|skipped", []byte(brewInfo), nil)
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "ripgrep", Binary: "rg"},
+		{Command: "hashicorp/tap/terraform"},
+		{Command: "jq"},
+		{Command: "skipped"},
+	}}
+	l := New(cfg, mr)
+	l.Host = &models.Host{OS: "linux", Arch: "amd64"}
+	l.Path = filepath.Join(t.TempDir(), FileName)
+	return l
+}
+
+func TestBuild_LocksInstalledPackages(t *testing.T) {
+	l := newTestLocker(t)
+
+	f, missing, err := l.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if len(f.Packages) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", f.Packages)
+	}
+	rg, _ := f.Find("ripgrep")
+	if rg.Version != "14.1.0" || rg.Tap != "homebrew/core" {
+		t.Fatalf("unexpected ripgrep entry: %+v", rg)
+	}
+	if versions.BottleTag() != "" && rg.BottleSHA256 != "aaa" {
+		t.Fatalf("expected bottle checksum for this platform, got %+v", rg)
+	}
+	tf, _ := f.Find("terraform")
+	if tf.FullName != "hashicorp/tap/terraform" || tf.Version != "1.9.2" || tf.BottleSHA256 != "" {
+		t.Fatalf("outdated install must not record the stable bottle: %+v", tf)
+	}
+	if len(missing) != 2 {
+		t.Fatalf("expected jq and skipped to be reported missing, got %v", missing)
+	}
+}
+
+func TestExecute_WritesThenReads(t *testing.T) {
+	l := newTestLocker(t)
+
+	if err := l.Execute(context.Background(), false); err != nil {
+		t.Fatalf("Execute (write): %v", err)
+	}
+	f, err := Read(l.Path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if f.Schema != SchemaVersion || len(f.Packages) != 2 || f.Packages[0].Name != "ripgrep" {
+		t.Fatalf("unexpected lock file: %+v", f)
+	}
+
+	// Existing lock without --update: only compares
+	if err := l.Execute(context.Background(), false); err != nil {
+		t.Fatalf("Execute (check): %v", err)
+	}
+}
+
+func TestExecute_DryRunWritesNothing(t *testing.T) {
+	l := newTestLocker(t)
+	l.Runner = &runner.DryRunner{Inner: l.Runner}
+
+	if err := l.Execute(context.Background(), true); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, err := os.Stat(l.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected no %s with --dry-run, got err=%v", FileName, err)
+	}
+}
+
+func TestRead_Missing(t *testing.T) {
+	if _, err := Read(filepath.Join(t.TempDir(), FileName)); !errors.Is(err, ErrNoLockFile) {
+		t.Fatalf("expected ErrNoLockFile, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	f := &File{Packages: []Entry{
+		{Name: "a", Version: "1.0.0"},
+		{Name: "b", Version: "2.0.0_1", BottleSHA256: "old"},
+		{Name: "c", Version: "3.0.0"},
+	}}
+	formulae := map[string]versions.Formula{
+		"a": {Name: "a", Installed: "1.0.1", Stable: "1.0.1"},
+		"b": {Name: "b", Stable: "2.0.0", BottleSHA256: "new"},
+		"c": {Name: "c", Stable: "3.0.0"},
+		"d": {Name: "d", Stable: "1.0.0"},
+	}
+	pkgs := []*models.Package{{Command: "a"}, {Command: "b"}, {Command: "c"}, {Command: "d"}}
+
+	got := map[string]string{}
+	for _, d := range Check(f, formulae, pkgs, false) {
+		got[d.Name] = d.Reason
+	}
+
+	want := map[string]string{
+		"a": "installed version differs",
+		"b": "bottle checksum differs",
+		"d": "not in keg.lock",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+
+	if drifts := Check(f, formulae, pkgs, true); len(drifts) != 1 || drifts[0].Name != "a" {
+		t.Fatalf("installedOnly must only report installed packages, got %+v", drifts)
+	}
+}
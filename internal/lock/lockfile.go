@@ -0,0 +1,109 @@
+package lock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FileName      = "keg.lock"
+	SchemaVersion = 1
+)
+
+var ErrNoLockFile = errors.New("no keg.lock found, run 'keg lock' first")
+
+// Entry pins one managed package to what was installed when the lock was
+// written.
+type Entry struct {
+	Name         string `yaml:"name"`
+	FullName     string `yaml:"full_name"`
+	Tap          string `yaml:"tap,omitempty"`
+	Version      string `yaml:"version"`
+	BottleSHA256 string `yaml:"bottle_sha256,omitempty"`
+}
+
+// File is the content of keg.lock.
+type File struct {
+	Schema      int       `yaml:"schema"`
+	GeneratedAt time.Time `yaml:"generated_at"`
+	Packages    []Entry   `yaml:"packages"`
+}
+
+// Find returns the entry locked for a short formula name.
+func (f *File) Find(name string) (Entry, bool) {
+	for _, e := range f.Packages {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Path returns the keg.lock sitting next to the configured keg.yml.
+func Path() (string, error) {
+	pconf, err := globalconfig.LoadPersistentConfig()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(pconf.Manifest()), FileName), nil
+}
+
+// Read loads a lock file, returning ErrNoLockFile when it does not exist.
+func Read(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoLockFile
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML from %s: %w", path, err)
+	}
+	if f.Schema > SchemaVersion {
+		return nil, fmt.Errorf("%s uses schema %d, this keg only knows up to %d", path, f.Schema, SchemaVersion)
+	}
+	return &f, nil
+}
+
+// Write stores f at path atomically, entries sorted by name so the file
+// diffs cleanly in review.
+func Write(path string, f *File) error {
+	data, err := Encode(f)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(path+".tmp", path, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// Encode renders f as the content of keg.lock.
+func Encode(f *File) ([]byte, error) {
+	sort.Slice(f.Packages, func(i, j int) bool { return f.Packages[i].Name < f.Packages[j].Name })
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by keg lock. Do not edit by hand.\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return nil, fmt.Errorf("failed to marshal lock file: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal lock file: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,265 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/plan"
+	"github.com/MrSnakeDoc/keg/internal/printer"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+	"github.com/MrSnakeDoc/keg/internal/versions"
+)
+
+var ErrDiverged = errors.New("this machine diverges from keg.lock")
+
+// Drift describes a package whose state does not match keg.lock.
+type Drift struct {
+	Name   string
+	Locked string
+	Actual string
+	Reason string
+}
+
+type Locker struct {
+	Config *models.Config
+	Runner runner.CommandRunner
+	Host   *models.Host
+	// Path of keg.lock; defaults to the one next to keg.yml.
+	Path string
+}
+
+func New(config *models.Config, r runner.CommandRunner) *Locker {
+	if r == nil {
+		r = runner.New()
+	}
+	return &Locker{
+		Config: config,
+		Runner: r,
+		Host:   utils.CurrentHost(),
+	}
+}
+
+// Load reads the keg.lock sitting next to keg.yml.
+func Load() (*File, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return Read(path)
+}
+
+// Execute writes keg.lock when it is missing or update is set. Otherwise it
+// reports how the installed packages differ from the lock.
+func (l *Locker) Execute(ctx context.Context, update bool) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	path := l.Path
+	if path == "" {
+		p, err := Path()
+		if err != nil {
+			return err
+		}
+		path = p
+	}
+
+	existing, err := Read(path)
+	switch {
+	case errors.Is(err, ErrNoLockFile) || (err == nil && update):
+		return l.write(ctx, path)
+	case err != nil:
+		return err
+	}
+
+	drifts, err := Verify(ctx, l.Runner, existing, l.managed(), true)
+	if err != nil {
+		return err
+	}
+	drifts = append(drifts, l.stale(existing)...)
+
+	if len(drifts) == 0 {
+		logger.Success("%s is up to date", FileName)
+		return nil
+	}
+	if err := RenderDrifts(drifts); err != nil {
+		return err
+	}
+	logger.Info("Run 'keg lock --update' to refresh %s", FileName)
+	return nil
+}
+
+func (l *Locker) write(ctx context.Context, path string) error {
+	f, missing, err := l.Build(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range missing {
+		logger.Warn("%s is not installed and was left out of %s", name, FileName)
+	}
+	// With --dry-run, the new keg.lock only shows in the plan
+	if runner.IsDryRun(l.Runner) {
+		data, err := Encode(f)
+		if err != nil {
+			return err
+		}
+		plan.RecordEdit(path, data)
+		return nil
+	}
+	if err := Write(path, f); err != nil {
+		return err
+	}
+	logger.Success("Wrote %s (%d packages)", path, len(f.Packages))
+	return nil
+}
+
+// Build resolves every managed package that is installed on this host.
+// It also returns the names of the managed packages that are not installed.
+func (l *Locker) Build(ctx context.Context) (*File, []string, error) {
+	pkgs := l.managed()
+	formulae, err := fetch(ctx, l.Runner, pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f := &File{Schema: SchemaVersion, GeneratedAt: time.Now().UTC().Truncate(time.Second)}
+	var missing []string
+	for _, p := range pkgs {
+		name := p.FormulaName()
+		info, ok := formulae[name]
+		if !ok || info.Installed == "" {
+			if !p.Optional {
+				missing = append(missing, name)
+			}
+			continue
+		}
+
+		e := Entry{
+			Name:     name,
+			FullName: info.FullName,
+			Tap:      info.Tap,
+			Version:  info.Installed,
+		}
+		if e.FullName == "" {
+			e.FullName = p.FullName()
+		}
+		// The bottle brew reports is the one of the current stable version
+		if utils.MatchesVersion(info.Installed, info.Stable) {
+			e.BottleSHA256 = info.BottleSHA256
+		}
+		f.Packages = append(f.Packages, e)
+	}
+	return f, missing, nil
+}
+
+// managed returns the packages of the manifest that apply to this host.
+func (l *Locker) managed() []*models.Package {
+	out := make([]*models.Package, 0, len(l.Config.Packages))
+	for i := range l.Config.Packages {
+		if p := &l.Config.Packages[i]; p.AvailableOn(l.Host) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// stale reports lock entries whose package left keg.yml.
+func (l *Locker) stale(f *File) []Drift {
+	known := make(map[string]bool, len(l.Config.Packages))
+	for i := range l.Config.Packages {
+		known[l.Config.Packages[i].FormulaName()] = true
+	}
+	var out []Drift
+	for _, e := range f.Packages {
+		if !known[e.Name] {
+			out = append(out, Drift{Name: e.Name, Locked: e.Version, Actual: "-", Reason: "no longer in keg.yml"})
+		}
+	}
+	return out
+}
+
+// Verify compares pkgs against f. Installed packages must be at their
+// locked version; packages that are not installed must be installable at
+// that version (brew only installs the current stable one). With
+// installedOnly, packages that are not installed are skipped.
+func Verify(ctx context.Context, r runner.CommandRunner, f *File, pkgs []*models.Package, installedOnly bool) ([]Drift, error) {
+	formulae, err := fetch(ctx, r, pkgs)
+	if err != nil {
+		return nil, err
+	}
+	return Check(f, formulae, pkgs, installedOnly), nil
+}
+
+// Check is Verify on already fetched formulae.
+func Check(f *File, formulae map[string]versions.Formula, pkgs []*models.Package, installedOnly bool) []Drift {
+	var out []Drift
+	for _, p := range pkgs {
+		name := p.FormulaName()
+		info := formulae[name]
+		if installedOnly && info.Installed == "" {
+			continue
+		}
+
+		e, ok := f.Find(name)
+		if !ok {
+			out = append(out, Drift{Name: name, Locked: "-", Actual: orDash(info.Installed), Reason: "not in keg.lock"})
+			continue
+		}
+
+		if info.Installed != "" {
+			if info.Installed != e.Version {
+				out = append(out, Drift{Name: name, Locked: e.Version, Actual: info.Installed, Reason: "installed version differs"})
+			}
+			continue
+		}
+
+		locked, _, _ := strings.Cut(e.Version, "_")
+		switch {
+		case info.Stable == "":
+			out = append(out, Drift{Name: name, Locked: e.Version, Actual: "-", Reason: "unknown to brew"})
+		case info.Stable != locked:
+			out = append(out, Drift{Name: name, Locked: e.Version, Actual: info.Stable, Reason: "brew would install another version"})
+		case e.BottleSHA256 != "" && info.BottleSHA256 != "" && e.BottleSHA256 != info.BottleSHA256:
+			out = append(out, Drift{Name: name, Locked: e.Version, Actual: info.Stable, Reason: "bottle checksum differs"})
+		}
+	}
+	return out
+}
+
+// RenderDrifts prints drifts as a table.
+func RenderDrifts(drifts []Drift) error {
+	p := printer.NewColorPrinter()
+	table := logger.CreateTable([]string{"Package", "Locked", "Actual", "Status"})
+	for _, d := range drifts {
+		if err := table.Append([]string{d.Name, d.Locked, d.Actual, p.Warning(d.Reason)}); err != nil {
+			return fmt.Errorf("append to table: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("render table: %w", err)
+	}
+	return nil
+}
+
+// fetch asks brew about pkgs, by fully qualified name so tap formulae
+// resolve without being tapped under another name.
+func fetch(ctx context.Context, r runner.CommandRunner, pkgs []*models.Package) (map[string]versions.Formula, error) {
+	names := make([]string, 0, len(pkgs))
+	for _, p := range pkgs {
+		names = append(names, p.FullName())
+	}
+	return versions.NewResolver(r).Formulae(ctx, names)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -14,24 +14,10 @@ var (
 
 func ConfigureLoggerFromFlags() {
 	var out io.Writer = os.Stdout
-	var level string
-	switch {
-	case FlagQuiet:
-		level = "error"
-		out = os.Stdout // errors only
-	case FlagSilent:
+	level := LevelFromFlags()
+	if level == "silent" {
 		level = "error" // silent = no output at all, even errors
 		out = io.Discard
-	default:
-		// map -V levels
-		switch FlagVerboseCount {
-		case 0:
-			level = "info"
-		case 1:
-			level = "debug"
-		default:
-			level = "debug" // -VV, -VVV... keep debug (could add trace later)
-		}
 	}
 
 	Configure(Options{
@@ -41,3 +27,18 @@ func ConfigureLoggerFromFlags() {
 		Out:   out,
 	})
 }
+
+// LevelFromFlags returns the level picked by the verbosity flags: "debug",
+// "info", "error" (--quiet) or "silent".
+func LevelFromFlags() string {
+	switch {
+	case FlagQuiet:
+		return "error" // errors only
+	case FlagSilent:
+		return "silent"
+	case FlagVerboseCount > 0:
+		return "debug" // -VV, -VVV... keep debug (could add trace later)
+	default:
+		return "info"
+	}
+}
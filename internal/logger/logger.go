@@ -25,6 +25,7 @@ var (
 	out      io.Writer = os.Stdout
 	p        *printer.ColorPrinter
 	curLevel = zapcore.InfoLevel
+	jsonOut  bool
 	ready    atomic.Bool
 )
 
@@ -42,6 +43,7 @@ func Configure(opts Options) {
 	encCfg.CallerKey = ""
 	encCfg.MessageKey = "msg"
 
+	jsonOut = opts.JSON
 	var enc zapcore.Encoder
 	if opts.JSON {
 		enc = zapcore.NewJSONEncoder(encCfg)
@@ -65,30 +67,24 @@ func Configure(opts Options) {
 
 // SetLevel adjusts current level at runtime ("debug","info","warn","error").
 func SetLevel(level string) {
-	mu.Lock()
-	defer mu.Unlock()
-	curLevel = parseLevel(level)
-	if zlog == nil {
-		Configure(Options{Level: level})
-		return
-	}
-	// rebuild core with new level
-	Configure(Options{Level: level, Out: out})
+	// Configure takes the lock itself and rebuilds the core with the level
+	mu.RLock()
+	opts := Options{Level: level, JSON: jsonOut, Out: out}
+	mu.RUnlock()
+	Configure(opts)
 }
 
-// SetOutput replaces the logger writer (use io.Discard in tests).
+// SetOutput replaces the logger writer (use io.Discard in tests), keeping
+// the current level and format.
 func SetOutput(w io.Writer) {
-	mu.Lock()
-	defer mu.Unlock()
 	if w == nil {
 		w = os.Stdout
 	}
-	out = w
-	if zlog == nil {
-		Configure(Options{})
-		return
-	}
-	Configure(Options{Level: curLevel.String(), Out: out})
+	// Configure takes the lock itself
+	mu.RLock()
+	opts := Options{Level: curLevel.String(), JSON: jsonOut, Out: w}
+	mu.RUnlock()
+	Configure(opts)
 }
 
 // UseTestMode silences logs during tests.
@@ -0,0 +1,400 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// errUnsupportedLayout is returned when keg.yml is written in a way the
+// line-based editor does not handle (flow-style package lists, for
+// instance). SaveConfig then re-marshals the whole config, with a warning.
+var errUnsupportedLayout = errors.New("unsupported keg.yml layout")
+
+// document is keg.yml as lines of text plus the node tree parsed from them.
+// Edits only touch the lines of the affected package entries; everything
+// else, comments and blank lines included, is kept verbatim.
+type document struct {
+	lines    []string
+	finalEOL bool
+	root     *yaml.Node
+}
+
+func parseDocument(src []byte) (*document, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errUnsupportedLayout
+	}
+
+	text := string(src)
+	d := &document{root: doc.Content[0], finalEOL: strings.HasSuffix(text, "\n")}
+	if text = strings.TrimSuffix(text, "\n"); text != "" {
+		d.lines = strings.Split(text, "\n")
+	}
+	return d, nil
+}
+
+func (d *document) bytes() []byte {
+	out := strings.Join(d.lines, "\n")
+	if d.finalEOL || len(d.lines) > 0 {
+		out += "\n"
+	}
+	return []byte(out)
+}
+
+// splice replaces lines [from, to) with repl and re-parses the result so
+// node positions stay valid for the next edit.
+func (d *document) splice(from, to int, repl []string) error {
+	lines := make([]string, 0, len(d.lines)-(to-from)+len(repl))
+	lines = append(lines, d.lines[:from]...)
+	lines = append(lines, repl...)
+	lines = append(lines, d.lines[to:]...)
+
+	next, err := parseDocument((&document{lines: lines, finalEOL: d.finalEOL}).bytes())
+	if err != nil {
+		return fmt.Errorf("edit produced invalid YAML: %w", err)
+	}
+	*d = *next
+	return nil
+}
+
+// entry returns a top-level key node and its value, if present.
+func (d *document) entry(name string) (key, val *yaml.Node) {
+	for i := 0; i+1 < len(d.root.Content); i += 2 {
+		if d.root.Content[i].Value == name {
+			return d.root.Content[i], d.root.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// packages returns the `packages:` key node and its value, if present.
+func (d *document) packages() (key, seq *yaml.Node) {
+	return d.entry("packages")
+}
+
+// blockItems returns the entries of a block-style `packages:` list.
+func (d *document) blockItems() ([]*yaml.Node, error) {
+	return d.blockSequence("packages", yaml.MappingNode)
+}
+
+// blockSequence returns the items of a block-style top-level list whose
+// entries are all of the given kind.
+func (d *document) blockSequence(name string, kind yaml.Kind) ([]*yaml.Node, error) {
+	_, seq := d.entry(name)
+	if seq == nil || (seq.Kind == yaml.ScalarNode && seq.Tag == "!!null") ||
+		(seq.Kind == yaml.SequenceNode && len(seq.Content) == 0) {
+		return nil, nil
+	}
+	if seq.Kind != yaml.SequenceNode || seq.Style&yaml.FlowStyle != 0 {
+		return nil, errUnsupportedLayout
+	}
+	for _, item := range seq.Content {
+		if item.Kind != kind || item.Style&yaml.FlowStyle != 0 {
+			return nil, errUnsupportedLayout
+		}
+	}
+	return seq.Content, nil
+}
+
+// findItem returns the entry of command, which keg.yml must list.
+func (d *document) findItem(command string) (*yaml.Node, error) {
+	items, err := d.blockItems()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if v := mapValue(item, "command"); v != nil && v.Value == command {
+			return item, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not listed in keg.yml", command)
+}
+
+// itemSpan returns the line range [start, end) of a list entry, the
+// comment lines right above it included, and the column of its dash.
+func (d *document) itemSpan(item *yaml.Node) (start, end, dash int) {
+	first := item.Line - 1
+	dash = strings.Index(d.lines[first], "-")
+
+	start = first
+	for start > 0 && isComment(d.lines[start-1]) && indentOf(d.lines[start-1]) >= dash {
+		start--
+	}
+
+	end = first + 1
+	for end < len(d.lines) && (isBlank(d.lines[end]) || indentOf(d.lines[end]) > dash) {
+		end++
+	}
+	for end > first+1 && isBlank(d.lines[end-1]) {
+		end--
+	}
+	return start, end, dash
+}
+
+// render formats a package entry as list item lines at the given indentation.
+func render(item *yaml.Node, dash, key int) ([]string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(item); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	gap := key - dash - 1
+	if gap < 1 {
+		gap = 1
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, l := range lines {
+		if i == 0 {
+			lines[i] = strings.Repeat(" ", dash) + "-" + strings.Repeat(" ", gap) + l
+		} else if l != "" {
+			lines[i] = strings.Repeat(" ", dash+1+gap) + l
+		}
+	}
+	return lines, nil
+}
+
+// appendPackage adds a new entry after the last one, using the same
+// indentation as the existing entries.
+func (d *document) appendPackage(pkg *models.Package) error {
+	node, err := packageNode(pkg)
+	if err != nil {
+		return err
+	}
+	return d.appendItem("packages", yaml.MappingNode, node)
+}
+
+// appendTap adds a tap to the `taps:` list. A missing list is created right
+// above `packages:` and the comments introducing it, where it usually sits.
+func (d *document) appendTap(tap string) error {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tap}
+	if key, _ := d.entry("taps"); key != nil {
+		return d.appendItem("taps", yaml.ScalarNode, node)
+	}
+
+	lines, err := render(node, 2, 4)
+	if err != nil {
+		return err
+	}
+	block := append([]string{"taps:"}, lines...)
+
+	pkgKey, _ := d.packages()
+	if pkgKey == nil {
+		return d.splice(len(d.lines), len(d.lines), block)
+	}
+	at := pkgKey.Line - 1
+	for at > 0 && isComment(d.lines[at-1]) {
+		at--
+	}
+	if at == 0 {
+		// Comments reaching the top of the file are its header, not the
+		// introduction of `packages:`.
+		at = pkgKey.Line - 1
+	}
+	return d.splice(at, at, append(block, ""))
+}
+
+// appendItem adds node after the last item of the top-level list name,
+// using the same indentation as the existing items.
+func (d *document) appendItem(name string, kind yaml.Kind, node *yaml.Node) error {
+	items, err := d.blockSequence(name, kind)
+	if err != nil {
+		return err
+	}
+
+	if len(items) > 0 {
+		last := items[len(items)-1]
+		_, end, dash := d.itemSpan(last)
+		lines, err := render(node, dash, last.Column-1)
+		if err != nil {
+			return err
+		}
+		return d.splice(end, end, lines)
+	}
+
+	// Empty list: rewrite `name: []` (or a bare `name:`) as a block.
+	key, seq := d.entry(name)
+	if key == nil {
+		lines, err := render(node, 2, 4)
+		if err != nil {
+			return err
+		}
+		return d.splice(len(d.lines), len(d.lines), append([]string{name + ":"}, lines...))
+	}
+
+	keyLine := key.Line - 1
+	dash := key.Column + 1
+	lines, err := render(node, dash, dash+2)
+	if err != nil {
+		return err
+	}
+	header := d.lines[keyLine]
+	if seq != nil && seq.Line-1 == keyLine && seq.Column > key.Column {
+		header = strings.TrimRight(header[:seq.Column-1], " ")
+	}
+	return d.splice(keyLine, keyLine+1, append([]string{header}, lines...))
+}
+
+// replacePackage rewrites the lines of an existing entry after its node has
+// been modified. Comments above the entry are kept.
+func (d *document) replacePackage(item *yaml.Node) error {
+	first := item.Line - 1
+	_, end, dash := d.itemSpan(item)
+
+	// The comment lines above the entry are kept as they are, not re-rendered.
+	item.HeadComment = ""
+	if len(item.Content) > 0 {
+		item.Content[0].HeadComment = ""
+	}
+	lines, err := render(item, dash, item.Column-1)
+	if err != nil {
+		return err
+	}
+	return d.splice(first, end, lines)
+}
+
+// rewritePackage replaces the lines of an existing entry with pkg encoded
+// afresh. Comments above the entry are kept, those inside it are not.
+func (d *document) rewritePackage(item *yaml.Node, pkg *models.Package) error {
+	node, err := packageNode(pkg)
+	if err != nil {
+		return err
+	}
+	_, end, dash := d.itemSpan(item)
+	lines, err := render(node, dash, item.Column-1)
+	if err != nil {
+		return err
+	}
+	return d.splice(item.Line-1, end, lines)
+}
+
+// removePackage deletes an entry with the comments right above it, and
+// drops the blank line that would otherwise be doubled or left dangling.
+func (d *document) removePackage(item *yaml.Node) error {
+	start, end, dash := d.itemSpan(item)
+	if start > 0 && isBlank(d.lines[start-1]) {
+		switch {
+		case end < len(d.lines) && isBlank(d.lines[end]):
+			end++
+		case end == len(d.lines) || indentOf(d.lines[end]) < dash:
+			start--
+		}
+	}
+	return d.splice(start, end, nil)
+}
+
+// packageNode encodes pkg as a mapping node, with groups and args in flow
+// style (`groups: [k8s]`) as in the documentation.
+func packageNode(pkg *models.Package) (*yaml.Node, error) {
+	var n yaml.Node
+	if err := n.Encode(pkg); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"groups", "args"} {
+		if v := mapValue(&n, key); v != nil {
+			v.Style = yaml.FlowStyle
+		}
+	}
+	return &n, nil
+}
+
+// addGroupNodes appends groups to the `groups:` list of an entry, creating
+// it when missing.
+func addGroupNodes(item *yaml.Node, groups []string) {
+	seq := mapValue(item, "groups")
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		setMapValue(item, "groups", seq)
+	}
+	for _, g := range groups {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: g})
+	}
+}
+
+func mapValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMapValue(n *yaml.Node, key string, val *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = val
+			return
+		}
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, val)
+}
+
+func isBlank(l string) bool   { return strings.TrimSpace(l) == "" }
+func isComment(l string) bool { return strings.HasPrefix(strings.TrimSpace(l), "#") }
+func indentOf(l string) int   { return len(l) - len(strings.TrimLeft(l, " \t")) }
+
+// editSource applies fn to cfg.Source. When keg.yml is laid out in a way
+// the editor does not handle, cfg.Source is dropped with a warning so
+// SaveConfig re-marshals the config instead. Any other failure is returned,
+// and cfg.Source is left as it was.
+func editSource(cfg *models.Config, fn func(d *document) error) error {
+	if cfg.Source == nil {
+		return nil
+	}
+	d, err := parseDocument(cfg.Source)
+	if err == nil {
+		err = fn(d)
+	}
+	switch {
+	case errors.Is(err, errUnsupportedLayout):
+		logger.Warn("keg.yml cannot be edited in place, it will be rewritten without its comments")
+		cfg.Source = nil
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to edit keg.yml: %w", err)
+	}
+	cfg.Source = d.bytes()
+	return nil
+}
+
+// Source returns cfg.Source when it still describes cfg, so keg.yml can be
+// written back exactly as edited. It returns false when the config was
+// changed without going through this package, or has no source at all.
+func Source(cfg *models.Config) ([]byte, bool) {
+	if cfg.Source == nil {
+		return nil, false
+	}
+	var onDisk models.Config
+	if err := yaml.Unmarshal(cfg.Source, &onDisk); err != nil {
+		return nil, false
+	}
+	if !sameList(onDisk.Packages, cfg.LocalPackages()) ||
+		!sameList(onDisk.Taps, cfg.Taps) ||
+		!sameList(onDisk.Include, cfg.Include) {
+		return nil, false
+	}
+	return cfg.Source, true
+}
+
+func sameList[T any](a, b []T) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,283 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+const curated = `# Team workstation manifest
+taps:
+  - hashicorp/tap
+
+packages:
+  # Shell essentials
+  - command: zoxide
+  - command: ripgrep
+    binary: rg # used by editors
+
+  # Kubernetes
+  - command: kubectx
+    groups: [k8s]
+  - command: k9s
+    optional: true
+`
+
+func loadCurated(t *testing.T) *models.Config {
+	t.Helper()
+	var cfg models.Config
+	if err := yaml.Unmarshal([]byte(curated), &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	cfg.Source = []byte(curated)
+	return &cfg
+}
+
+func finder(cfg *models.Config) Finder {
+	return func(name string) (*models.Package, bool) {
+		for i := range cfg.Packages {
+			if cfg.Packages[i].Command == name {
+				return &cfg.Packages[i], true
+			}
+		}
+		return nil, false
+	}
+}
+
+func source(t *testing.T, cfg *models.Config) string {
+	t.Helper()
+	data, ok := Source(cfg)
+	if !ok {
+		t.Fatalf("source out of sync with config:\n%s", cfg.Source)
+	}
+	return string(data)
+}
+
+func TestAddPackages_AppendsAndKeepsTheRest(t *testing.T) {
+	cfg := loadCurated(t)
+	if _, err := AddPackages(cfg, finder(cfg), []string{"bat"}, "batcat", false, []string{"cli"}); err != nil {
+		t.Fatalf("AddPackages: %v", err)
+	}
+
+	want := curated + "  - command: bat\n    binary: batcat\n    groups: [cli]\n"
+	if got := source(t, cfg); got != want {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAddPackages_MergesGroupsInPlace(t *testing.T) {
+	cfg := loadCurated(t)
+	if _, err := AddPackages(cfg, finder(cfg), []string{"ripgrep", "kubectx"}, "", false, []string{"k8s", "search"}); err != nil {
+		t.Fatalf("AddPackages: %v", err)
+	}
+
+	want := strings.Replace(curated,
+		"    binary: rg # used by editors\n",
+		"    binary: rg # used by editors\n    groups: [k8s, search]\n", 1)
+	want = strings.Replace(want, "groups: [k8s]\n  - command: k9s", "groups: [k8s, search]\n  - command: k9s", 1)
+	if got := source(t, cfg); got != want {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAddPackages_LeavesIncludedPackages(t *testing.T) {
+	cfg := loadCurated(t)
+	cfg.Packages = append(cfg.Packages, models.Package{Command: "kubectl", Origin: "base.yml"})
+
+	modified, err := AddPackages(cfg, finder(cfg), []string{"kubectl"}, "", false, []string{"k8s"})
+	if err != nil {
+		t.Fatalf("AddPackages: %v", err)
+	}
+	if modified {
+		t.Fatalf("expected an included package to be left alone")
+	}
+	if got := source(t, cfg); got != curated {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, curated)
+	}
+}
+
+func TestAddPackages_MissingEntryFails(t *testing.T) {
+	cfg := loadCurated(t)
+	// Listed in the config but not in keg.yml, as if edited out of band
+	cfg.Packages = append(cfg.Packages, models.Package{Command: "jq"})
+
+	if _, err := AddPackages(cfg, finder(cfg), []string{"jq"}, "", false, []string{"cli"}); err == nil {
+		t.Fatalf("expected an error for an entry keg.yml does not have")
+	}
+	if string(cfg.Source) != curated {
+		t.Fatalf("expected keg.yml to be kept, got:\n%s", cfg.Source)
+	}
+}
+
+func TestRemovePackages_DropsOnlyTheEntry(t *testing.T) {
+	cfg := loadCurated(t)
+	if _, err := RemovePackages(cfg, []string{"ripgrep", "k9s"}); err != nil {
+		t.Fatalf("RemovePackages: %v", err)
+	}
+
+	want := strings.Replace(curated, "  - command: ripgrep\n    binary: rg # used by editors\n", "", 1)
+	want = strings.Replace(want, "  - command: k9s\n    optional: true\n", "", 1)
+	if got := source(t, cfg); got != want {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRemovePackages_DropsCommentAboveEntry(t *testing.T) {
+	cfg := loadCurated(t)
+	if _, err := RemovePackages(cfg, []string{"kubectx", "k9s"}); err != nil {
+		t.Fatalf("RemovePackages: %v", err)
+	}
+
+	want := strings.Replace(curated, "\n  # Kubernetes\n  - command: kubectx\n    groups: [k8s]\n  - command: k9s\n    optional: true\n", "", 1)
+	if got := source(t, cfg); got != want {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRemovePackages_KeepsIncludedPackages(t *testing.T) {
+	cfg := loadCurated(t)
+	cfg.Packages = append(cfg.Packages, models.Package{Command: "kubectl", Origin: "base.yml"})
+
+	removed, err := RemovePackages(cfg, []string{"kubectl"})
+	if err != nil {
+		t.Fatalf("RemovePackages: %v", err)
+	}
+	if removed || len(cfg.Packages) != 5 {
+		t.Fatalf("expected the included package to be kept, got %+v", cfg.Packages)
+	}
+	if got := source(t, cfg); got != curated {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, curated)
+	}
+}
+
+func TestAddPackages_EmptyList(t *testing.T) {
+	src := "# empty for now\npackages: []\n"
+	cfg := &models.Config{Source: []byte(src)}
+	if _, err := AddPackages(cfg, finder(cfg), []string{"fd"}, "", true, nil); err != nil {
+		t.Fatalf("AddPackages: %v", err)
+	}
+
+	want := "# empty for now\npackages:\n  - command: fd\n    optional: true\n"
+	if got := source(t, cfg); got != want {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEdits_FlowStyleFallsBack(t *testing.T) {
+	cfg := &models.Config{
+		Packages: []models.Package{{Command: "fd"}},
+		Source:   []byte("packages: [{command: fd}]\n"),
+	}
+	if _, err := AddPackages(cfg, finder(cfg), []string{"bat"}, "", false, nil); err != nil {
+		t.Fatalf("AddPackages: %v", err)
+	}
+	if _, ok := Source(cfg); ok {
+		t.Fatalf("expected flow-style manifest to fall back to re-marshaling")
+	}
+}
+
+func TestSource_DetectsOutOfBandChanges(t *testing.T) {
+	cfg := loadCurated(t)
+	cfg.Packages = append(cfg.Packages, models.Package{Command: "jq"})
+	if _, ok := Source(cfg); ok {
+		t.Fatalf("expected Source to notice packages added without the editor")
+	}
+}
+
+func TestAddTaps(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		taps  []string
+		want  string
+		added int
+	}{
+		{
+			name:  "appends to the existing list",
+			src:   curated,
+			taps:  []string{"hashicorp/tap", "owner/homebrew-tools"},
+			want:  strings.Replace(curated, "  - hashicorp/tap\n", "  - hashicorp/tap\n  - owner/homebrew-tools\n", 1),
+			added: 1,
+		},
+		{
+			name:  "creates the list above packages and its comments",
+			src:   "include: [base.yml]\n\n# Tools\npackages:\n  - command: fd\n",
+			taps:  []string{"owner/tools"},
+			want:  "include: [base.yml]\n\ntaps:\n  - owner/tools\n\n# Tools\npackages:\n  - command: fd\n",
+			added: 1,
+		},
+		{
+			name:  "keeps the file header on top",
+			src:   "# Tools\npackages:\n  - command: fd\n",
+			taps:  []string{"owner/tools"},
+			want:  "# Tools\ntaps:\n  - owner/tools\n\npackages:\n  - command: fd\n",
+			added: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg models.Config
+			if err := yaml.Unmarshal([]byte(tt.src), &cfg); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			cfg.Source = []byte(tt.src)
+
+			added, err := AddTaps(&cfg, tt.taps)
+			if err != nil {
+				t.Fatalf("AddTaps: %v", err)
+			}
+			if len(added) != tt.added {
+				t.Fatalf("expected %d tap(s) added, got %v", tt.added, added)
+			}
+			if got := source(t, &cfg); got != tt.want {
+				t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatePackage_RewritesOnlyTheEntry(t *testing.T) {
+	cfg := loadCurated(t)
+	changed, err := UpdatePackage(cfg, finder(cfg), "zoxide", func(p *models.Package) bool {
+		p.Args = models.StringList{"--HEAD"}
+		p.Env = map[string]string{"HOMEBREW_NO_AUTO_UPDATE": "1"}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("UpdatePackage: %v", err)
+	}
+	if !changed {
+		t.Fatalf("expected UpdatePackage to report a change")
+	}
+
+	want := strings.Replace(curated,
+		"  - command: zoxide\n",
+		"  - command: zoxide\n    args: [--HEAD]\n    env:\n      HOMEBREW_NO_AUTO_UPDATE: \"1\"\n", 1)
+	if got := source(t, cfg); got != want {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, want)
+	}
+
+	if changed, _ := UpdatePackage(cfg, finder(cfg), "missing", func(*models.Package) bool { return true }); changed {
+		t.Fatalf("expected no change for an unknown package")
+	}
+}
+
+func TestUpdatePackage_LeavesIncludedPackages(t *testing.T) {
+	cfg := loadCurated(t)
+	cfg.Packages = append(cfg.Packages, models.Package{Command: "kubectl", Origin: "base.yml"})
+
+	changed, err := UpdatePackage(cfg, finder(cfg), "kubectl", func(p *models.Package) bool {
+		p.Args = models.StringList{"--HEAD"}
+		return true
+	})
+	if err != nil || changed {
+		t.Fatalf("expected an included package to be left alone, changed=%v err=%v", changed, err)
+	}
+	if got := source(t, cfg); got != curated {
+		t.Fatalf("unexpected keg.yml:\n%s\nwant:\n%s", got, curated)
+	}
+}
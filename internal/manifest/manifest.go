@@ -2,7 +2,9 @@ package manifest
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/MrSnakeDoc/keg/internal/models"
 	"github.com/MrSnakeDoc/keg/internal/utils"
 )
@@ -11,8 +13,11 @@ import (
 type Finder func(name string) (*models.Package, bool)
 
 // AddPackages mutates cfg.Packages by appending new packages if absent.
+// Packages already present only get the missing groups added, unless they
+// come from an include, which keg.yml cannot change.
+// The same edits are applied to cfg.Source, leaving the rest of keg.yml as is.
 // Returns true if cfg was modified.
-func AddPackages(cfg *models.Config, find Finder, names []string, binary string, optional bool) (bool, error) {
+func AddPackages(cfg *models.Config, find Finder, names []string, binary string, optional bool, groups []string) (bool, error) {
 	if len(names) == 0 {
 		return false, fmt.Errorf("no package name provided, please specify at least one package")
 	}
@@ -22,8 +27,28 @@ func AddPackages(cfg *models.Config, find Finder, names []string, binary string,
 
 	modified := false
 	for idx, name := range names {
-		if _, exists := find(name); exists {
-			// Package already present, skip silently (idempotent)
+		if existing, exists := find(name); exists {
+			if existing.Origin != "" {
+				if len(groups) > 0 {
+					logger.Warn("%s comes from include %s, add the groups there", name, existing.Origin)
+				}
+				continue
+			}
+			// Package already present, only merge groups (idempotent)
+			if added := addGroups(existing, groups); len(added) > 0 {
+				modified = true
+				err := editSource(cfg, func(d *document) error {
+					item, err := d.findItem(existing.Command)
+					if err != nil {
+						return err
+					}
+					addGroupNodes(item, added)
+					return d.replacePackage(item)
+				})
+				if err != nil {
+					return modified, err
+				}
+			}
 			continue
 		}
 
@@ -31,6 +56,7 @@ func AddPackages(cfg *models.Config, find Finder, names []string, binary string,
 			Command:  name,
 			Optional: optional,
 		}
+		addGroups(&pkg, groups)
 		// Only first package can take the --binary (same rule as before)
 		if binary != "" && idx == 0 && binary != name {
 			pkg.Binary = binary
@@ -38,11 +64,29 @@ func AddPackages(cfg *models.Config, find Finder, names []string, binary string,
 
 		cfg.Packages = append(cfg.Packages, pkg)
 		modified = true
+		if err := editSource(cfg, func(d *document) error { return d.appendPackage(&pkg) }); err != nil {
+			return modified, err
+		}
 	}
 	return modified, nil
 }
 
-// RemovePackages removes packages by name from cfg.Packages.
+// addGroups appends the groups pkg does not belong to yet.
+// Returns the groups that were added.
+func addGroups(pkg *models.Package, groups []string) []string {
+	var added []string
+	for _, g := range groups {
+		if g == "" || pkg.InAnyGroup([]string{g}) {
+			continue
+		}
+		pkg.Groups = append(pkg.Groups, g)
+		added = append(added, g)
+	}
+	return added
+}
+
+// RemovePackages removes packages by name from cfg.Packages, and their
+// entries from cfg.Source. Packages from includes are kept.
 // Returns true if cfg was modified.
 func RemovePackages(cfg *models.Config, names []string) (bool, error) {
 	if len(names) == 0 {
@@ -57,8 +101,18 @@ func RemovePackages(cfg *models.Config, names []string) (bool, error) {
 	removed := false
 
 	for _, p := range cfg.Packages {
-		if _, hit := nameSet[p.Command]; hit {
+		if _, hit := nameSet[p.Command]; hit && p.Origin == "" {
 			removed = true
+			err := editSource(cfg, func(d *document) error {
+				item, err := d.findItem(p.Command)
+				if err != nil {
+					return err
+				}
+				return d.removePackage(item)
+			})
+			if err != nil {
+				return false, err
+			}
 			continue
 		}
 		out = append(out, p)
@@ -69,3 +123,55 @@ func RemovePackages(cfg *models.Config, names []string) (bool, error) {
 	}
 	return removed, nil
 }
+
+// AddTaps appends to cfg.Taps the taps that neither keg.yml nor its includes
+// list yet, and mirrors them into cfg.Source.
+// Returns the taps that were added.
+func AddTaps(cfg *models.Config, taps []string) ([]string, error) {
+	known := make(map[string]bool)
+	for _, t := range cfg.AllTaps() {
+		known[utils.NormalizeTap(t)] = true
+	}
+
+	var added []string
+	for _, tap := range taps {
+		key := utils.NormalizeTap(tap)
+		if key == "" || known[key] {
+			continue
+		}
+		known[key] = true
+		tap = strings.TrimSpace(tap)
+		cfg.Taps = append(cfg.Taps, tap)
+		added = append(added, tap)
+		if err := editSource(cfg, func(d *document) error { return d.appendTap(tap) }); err != nil {
+			return added, err
+		}
+	}
+	return added, nil
+}
+
+// UpdatePackage applies fn to the package called name and re-renders its
+// entry in cfg.Source when fn reports a change. Packages from includes are
+// left alone.
+// Returns true if cfg was modified.
+func UpdatePackage(cfg *models.Config, find Finder, name string, fn func(p *models.Package) bool) (bool, error) {
+	pkg, ok := find(name)
+	if !ok {
+		return false, nil
+	}
+	if pkg.Origin != "" {
+		logger.Warn("%s comes from include %s, edit it there", name, pkg.Origin)
+		return false, nil
+	}
+	if !fn(pkg) {
+		return false, nil
+	}
+	err := editSource(cfg, func(d *document) error {
+		item, err := d.findItem(pkg.Command)
+		if err != nil {
+			return err
+		}
+		return d.rewritePackage(item, pkg)
+	})
+	return err == nil, err
+}
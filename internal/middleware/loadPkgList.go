@@ -3,16 +3,26 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/include"
+	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/MrSnakeDoc/keg/internal/models"
-	"github.com/MrSnakeDoc/keg/internal/utils"
+	"github.com/MrSnakeDoc/keg/internal/validator"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 // LoadConfig loads the package configuration from keg.yml
 // It extracts the path to the packages file from the command context coming from the middleware RequireConfig
 func LoadConfig(cmd *cobra.Command) (*models.Config, error) {
+	return loadConfig(cmd, false)
+}
+
+// loadConfig is LoadConfig; offline takes remote includes from the cache
+// only (see include.Resolver.Offline).
+func loadConfig(cmd *cobra.Command, offline bool) (*models.Config, error) {
 	var config models.Config
 
 	// First, load global config to get packages file path
@@ -21,15 +31,63 @@ func LoadConfig(cmd *cobra.Command) (*models.Config, error) {
 		return nil, err
 	}
 
+	path := globalCfg.Manifest()
+
 	// Read packages configuration file
-	err = utils.FileReader(globalCfg.PackagesFile, "yaml", &config)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read packages file %s: %w", globalCfg.PackagesFile, err)
+		return nil, fmt.Errorf("failed to read packages file %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("failed to read packages file %s: file is empty", path)
+	}
+
+	if err := validateManifest(path, data); err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to read packages file %s: failed to unmarshal YAML: %w", path, err)
+	}
+	config.Source = data
+
+	// The other manifests of the profile sit below keg.yml and its includes
+	var extra []models.Include
+	for _, m := range globalCfg.Manifests[min(1, len(globalCfg.Manifests)):] {
+		extra = append(extra, models.Include{Path: m})
+	}
+
+	// Merge included manifests (local files or HTTPS URLs) below keg.yml
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	resolver := include.NewResolver(nil)
+	resolver.Offline = offline
+	if err := resolver.Resolve(ctx, &config, path, extra...); err != nil {
+		return nil, fmt.Errorf("failed to resolve includes of %s: %w", path, err)
 	}
 
 	return &config, nil
 }
 
+// validateManifest reports problems in keg.yml before it is decoded, so typos
+// in keys are not silently dropped. Warnings are logged; errors abort.
+func validateManifest(path string, data []byte) error {
+	diags := validator.Check(path, data)
+	for _, d := range diags {
+		if d.Severity == validator.SeverityWarning {
+			logger.Warn("%s", d)
+		} else {
+			logger.LogError("%s", d)
+		}
+	}
+	if validator.HasErrors(diags) {
+		return ErrLogged
+	}
+	return nil
+}
+
 func LoadPkgList(cmd *cobra.Command, args []string, next func(cmd *cobra.Command, args []string) error) error {
 	cfg, err := LoadConfig(cmd)
 	if err != nil {
@@ -41,3 +99,16 @@ func LoadPkgList(cmd *cobra.Command, args []string, next func(cmd *cobra.Command
 
 	return next(cmd, args)
 }
+
+// LoadCachedPkgList is LoadPkgList without network access, for commands
+// that run on every shell start: remote includes come from the cache, the
+// ones never fetched are left out.
+func LoadCachedPkgList(cmd *cobra.Command, args []string, next func(cmd *cobra.Command, args []string) error) error {
+	cfg, err := loadConfig(cmd, true)
+	if err != nil {
+		return err
+	}
+
+	cmd.SetContext(context.WithValue(cmd.Context(), CtxKeyConfig, cfg))
+	return next(cmd, args)
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"os"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// LogToStderr sends log messages to stderr, for commands whose stdout is
+// evaluated by the shell or redirected to a file, unless their --output flag
+// sends the result elsewhere. It goes first in the chain so that the
+// warnings of the other middlewares stay out of stdout too.
+func LogToStderr(cmd *cobra.Command, args []string, next func(*cobra.Command, []string) error) error {
+	if output, _ := cmd.Flags().GetString("output"); output == "" && logger.LevelFromFlags() != "silent" {
+		logger.SetOutput(os.Stderr)
+	}
+	return next(cmd, args)
+}
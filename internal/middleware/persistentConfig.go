@@ -3,8 +3,10 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -13,6 +15,11 @@ func RequireConfig(cmd *cobra.Command, args []string, next func(cmd *cobra.Comma
 	if err != nil {
 		return fmt.Errorf("missing config: %w", err)
 	}
+	if pconf.Profile != "" {
+		logger.Debug("Using profile %s (%s)", pconf.Profile, strings.Join(pconf.Manifests, ", "))
+	} else {
+		logger.Debug("Using manifest %s", pconf.Manifest())
+	}
 
 	ctx := context.WithValue(cmd.Context(), CtxKeyPConfig, pconf)
 	cmd.SetContext(ctx)
@@ -0,0 +1,42 @@
+package models
+
+// Hook stages, as written in keg.yml.
+const (
+	HookPreInstall   = "pre_install"
+	HookPostInstall  = "post_install"
+	HookPreUninstall = "pre_uninstall"
+	HookPostUpgrade  = "post_upgrade"
+)
+
+// Hooks are shell commands run around brew actions, either for one package
+// or, at the top of keg.yml, for every package keg acts on.
+//
+//	hooks:
+//	  post_install: bat cache --build
+//	  pre_uninstall:
+//	    - ./scripts/backup.sh
+type Hooks struct {
+	PreInstall   StringList `yaml:"pre_install,omitempty"`
+	PostInstall  StringList `yaml:"post_install,omitempty"`
+	PreUninstall StringList `yaml:"pre_uninstall,omitempty"`
+	PostUpgrade  StringList `yaml:"post_upgrade,omitempty"`
+}
+
+// For returns the commands of a stage. A nil Hooks has none.
+func (h *Hooks) For(stage string) []string {
+	if h == nil {
+		return nil
+	}
+	switch stage {
+	case HookPreInstall:
+		return h.PreInstall
+	case HookPostInstall:
+		return h.PostInstall
+	case HookPreUninstall:
+		return h.PreUninstall
+	case HookPostUpgrade:
+		return h.PostUpgrade
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Include points keg.yml at another manifest whose packages are merged in.
+//
+// It accepts either a mapping:
+//
+//	include:
+//	  - url: https://raw.githubusercontent.com/acme/dev/main/keg.yml
+//	    sha256: 9f86d08...
+//	  - path: ./team.yml
+//
+// or a bare string, treated as a URL when it starts with https:// and as
+// a local path otherwise.
+type Include struct {
+	Path   string `yaml:"path,omitempty"`
+	URL    string `yaml:"url,omitempty"`
+	SHA256 string `yaml:"sha256,omitempty"`
+}
+
+// UnmarshalYAML implements the scalar shorthand described on Include.
+func (i *Include) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		raw := strings.TrimSpace(value.Value)
+		if strings.Contains(raw, "://") {
+			i.URL = raw
+		} else {
+			i.Path = raw
+		}
+		return nil
+	}
+
+	type plain Include
+	var p plain
+	if err := value.Decode(&p); err != nil {
+		return err
+	}
+	*i = Include(p)
+	return nil
+}
+
+// MarshalYAML writes entries without a checksum back in the short form.
+func (i Include) MarshalYAML() (interface{}, error) {
+	if i.SHA256 == "" {
+		return i.Source(), nil
+	}
+	type plain Include
+	return plain(i), nil
+}
+
+// Source returns the URL or path of the include, for messages and origins.
+func (i *Include) Source() string {
+	if i.URL != "" {
+		return i.URL
+	}
+	return i.Path
+}
+
+// Validate checks that exactly one of path or url is set.
+func (i *Include) Validate() error {
+	switch {
+	case i.URL == "" && i.Path == "":
+		return fmt.Errorf("include entry needs a path or an url")
+	case i.URL != "" && i.Path != "":
+		return fmt.Errorf("include entry %q cannot set both path and url", i.URL)
+	}
+	return nil
+}
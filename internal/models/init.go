@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Shells keg shellenv writes a snippet for.
+const (
+	ShellZsh  = "zsh"
+	ShellBash = "bash"
+	ShellFish = "fish"
+)
+
+// Init holds the lines a package needs in interactive shells, added by
+// `keg shellenv`. It accepts one list per shell:
+//
+//	init:
+//	  zsh: eval "$(zoxide init zsh)"
+//	  fish: zoxide init fish | source
+//
+// or a bare string, used for both zsh and bash.
+type Init struct {
+	Zsh  StringList `yaml:"zsh,omitempty"`
+	Bash StringList `yaml:"bash,omitempty"`
+	Fish StringList `yaml:"fish,omitempty"`
+}
+
+// UnmarshalYAML implements the scalar shorthand described on Init.
+func (i *Init) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		line := strings.TrimSpace(value.Value)
+		if line != "" {
+			i.Zsh = StringList{line}
+			i.Bash = StringList{line}
+		}
+		return nil
+	}
+
+	type plain Init
+	var p plain
+	if err := value.Decode(&p); err != nil {
+		return err
+	}
+	*i = Init(p)
+	return nil
+}
+
+// For returns the lines of a shell. A nil Init has none.
+func (i *Init) For(shell string) []string {
+	if i == nil {
+		return nil
+	}
+	switch shell {
+	case ShellZsh:
+		return i.Zsh
+	case ShellBash:
+		return i.Bash
+	case ShellFish:
+		return i.Fish
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+// Link places a file or directory of the dotfiles directory on the machine,
+// either for one package (once it is installed) or at the top of keg.yml.
+//
+//	links:
+//	  - source: lazygit/config.yml
+//	    target: ~/.config/lazygit/config.yml
+//	  - source: git/gitconfig
+//	    target: ~/.gitconfig
+//	    copy: true
+type Link struct {
+	// Source is relative to the dotfiles directory.
+	Source string `yaml:"source"`
+	// Target is absolute, starts with ~, or is relative to the home directory.
+	Target string `yaml:"target"`
+	// Copy copies Source instead of symlinking it, for programs that
+	// rewrite their config or do not follow symlinks.
+	Copy bool `yaml:"copy,omitempty"`
+}
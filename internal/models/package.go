@@ -1,11 +1,142 @@
 package models
 
+import (
+	"sort"
+	"strings"
+)
+
 type Package struct {
-	Command  string `yaml:"command"`
-	Binary   string `yaml:"binary,omitempty"`
-	Optional bool   `yaml:"optional,omitempty"`
+	Command  string   `yaml:"command"`
+	Binary   string   `yaml:"binary,omitempty"`
+	Tap      string   `yaml:"tap,omitempty"`
+	Optional bool     `yaml:"optional,omitempty"`
+	Pin      bool     `yaml:"pin,omitempty"`
+	Version  string   `yaml:"version,omitempty"`
+	Groups   []string `yaml:"groups,omitempty"`
+	When     *When    `yaml:"when,omitempty"`
+
+	// Args are extra `brew install` flags (--HEAD, --build-from-source…),
+	// Env extra variables (HOMEBREW_*) for installs and upgrades.
+	Args StringList        `yaml:"args,omitempty"`
+	Env  map[string]string `yaml:"env,omitempty"`
+
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+	Links []Link `yaml:"links,omitempty"`
+	Init  *Init  `yaml:"init,omitempty"`
+
+	// Origin is the include (path or URL) the package was merged from.
+	// It is empty for packages declared in the local keg.yml.
+	Origin string `yaml:"-"`
 }
 
 type Config struct {
+	Include []Include `yaml:"include,omitempty"`
+	Taps    []string  `yaml:"taps,omitempty"`
+	Hooks   *Hooks    `yaml:"hooks,omitempty"`
+
+	// Dotfiles is the directory link sources are read from, relative to
+	// keg.yml. It defaults to the directory of keg.yml.
+	Dotfiles string    `yaml:"dotfiles,omitempty"`
+	Links    []Link    `yaml:"links,omitempty"`
 	Packages []Package `yaml:"packages"`
+
+	// IncludedTaps holds the taps merged from includes; they are never
+	// written back to keg.yml.
+	IncludedTaps []string `yaml:"-"`
+
+	// Source is the raw keg.yml the config was read from. The manifest
+	// package edits it in place so SaveConfig keeps comments and order.
+	Source []byte `yaml:"-"`
+}
+
+// AllTaps returns the local taps followed by the ones merged from includes.
+func (c *Config) AllTaps() []string {
+	return append(append([]string(nil), c.Taps...), c.IncludedTaps...)
+}
+
+// LocalPackages returns the packages declared in the local keg.yml,
+// leaving out everything merged from includes.
+func (c *Config) LocalPackages() []Package {
+	out := make([]Package, 0, len(c.Packages))
+	for _, p := range c.Packages {
+		if p.Origin == "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// FormulaName returns the short formula name, stripping any "owner/tap/"
+// prefix from a fully qualified command.
+func (p *Package) FormulaName() string {
+	if i := strings.LastIndex(p.Command, "/"); i >= 0 {
+		return p.Command[i+1:]
+	}
+	return p.Command
+}
+
+// TapName returns the tap hosting the formula, either declared explicitly
+// with `tap:` or derived from a fully qualified `owner/tap/formula` command.
+// It returns an empty string for formulae from homebrew/core.
+func (p *Package) TapName() string {
+	if p.Tap != "" {
+		return p.Tap
+	}
+	if parts := strings.Split(p.Command, "/"); len(parts) == 3 {
+		return parts[0] + "/" + parts[1]
+	}
+	return ""
+}
+
+// FullName returns the fully qualified `owner/tap/formula` name when the
+// package comes from a third-party tap, otherwise the plain formula name.
+func (p *Package) FullName() string {
+	if tap := p.TapName(); tap != "" {
+		return tap + "/" + p.FormulaName()
+	}
+	return p.FormulaName()
+}
+
+// IsPinned reports whether keg must hold the package at its installed
+// version: either `pin: true` or an explicit `version:` is declared.
+func (p *Package) IsPinned() bool {
+	return p.Pin || p.Version != ""
+}
+
+// InAnyGroup reports whether the package belongs to at least one of groups.
+func (p *Package) InAnyGroup(groups []string) bool {
+	for _, g := range groups {
+		for _, own := range p.Groups {
+			if strings.EqualFold(own, g) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Environ returns Env as sorted "KEY=value" pairs.
+func (p *Package) Environ() []string {
+	out := make([]string, 0, len(p.Env))
+	for k, v := range p.Env {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// UpgradeArgs returns the Args that apply to `brew upgrade`. Formulae
+// installed with --HEAD are upgraded with --fetch-HEAD; other install flags
+// only matter the first time.
+func (p *Package) UpgradeArgs() []string {
+	var out []string
+	for _, a := range p.Args {
+		switch a {
+		case "--HEAD":
+			out = append(out, "--fetch-HEAD")
+		case "--build-from-source", "-s", "--force-bottle":
+			out = append(out, a)
+		}
+	}
+	return out
 }
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StringList is a list of strings that can also be written as a single
+// scalar in YAML (`arch: arm64` or `arch: [arm64, amd64]`).
+type StringList []string
+
+// UnmarshalYAML implements the scalar shorthand described on StringList.
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = StringList{value.Value}
+		return nil
+	}
+	var out []string
+	if err := value.Decode(&out); err != nil {
+		return err
+	}
+	*l = out
+	return nil
+}
+
+// When restricts a package to the hosts it makes sense on. Every matcher
+// that is set must match; values inside a matcher are alternatives.
+//
+//	when:
+//	  os: linux
+//	  distro: [ubuntu, debian]
+//	  arch: arm64
+//	  hostname: "build-*"
+//	  env:
+//	    WSL_DISTRO_NAME: ""   # only needs to be set
+//	    CI: "true"
+type When struct {
+	OS       StringList        `yaml:"os,omitempty"`
+	Distro   StringList        `yaml:"distro,omitempty"`
+	Arch     StringList        `yaml:"arch,omitempty"`
+	Hostname StringList        `yaml:"hostname,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+}
+
+// Host describes the machine keg runs on, as seen by When.
+type Host struct {
+	OS         string
+	Arch       string
+	Hostname   string
+	Distro     string   // ID from /etc/os-release
+	DistroLike []string // ID_LIKE from /etc/os-release
+
+	// LookupEnv defaults to os.LookupEnv when nil.
+	LookupEnv func(string) (string, bool)
+}
+
+// archAliases maps the names uname and distros use to Go's GOARCH values.
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x64":     "amd64",
+	"aarch64": "arm64",
+	"armv7l":  "arm",
+	"i386":    "386",
+	"i686":    "386",
+}
+
+// Matches reports whether the host satisfies every matcher set on w.
+// A nil When matches everything.
+func (w *When) Matches(h *Host) bool {
+	if w == nil {
+		return true
+	}
+	if len(w.OS) > 0 && !anyEqual(w.OS, h.OS) {
+		return false
+	}
+	if len(w.Distro) > 0 && !anyEqual(w.Distro, append([]string{h.Distro}, h.DistroLike...)...) {
+		return false
+	}
+	if len(w.Arch) > 0 && !anyEqual(normalizeArch(w.Arch), normalizeArch([]string{h.Arch})...) {
+		return false
+	}
+	if len(w.Hostname) > 0 && !anyGlob(w.Hostname, h.Hostname) {
+		return false
+	}
+	return w.envMatches(h)
+}
+
+func (w *When) envMatches(h *Host) bool {
+	lookup := h.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	for key, want := range w.Env {
+		got, ok := lookup(key)
+		if !ok {
+			return false
+		}
+		if want != "" && !anyGlob([]string{want}, got) {
+			return false
+		}
+	}
+	return true
+}
+
+// AvailableOn reports whether the package applies to the given host.
+func (p *Package) AvailableOn(h *Host) bool {
+	return p.When.Matches(h)
+}
+
+func anyEqual(want []string, have ...string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h != "" && strings.EqualFold(strings.TrimSpace(w), h) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyGlob(patterns []string, s string) bool {
+	s = strings.ToLower(s)
+	for _, p := range patterns {
+		if ok, err := path.Match(strings.ToLower(strings.TrimSpace(p)), s); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeArch(in []string) []string {
+	out := make([]string, len(in))
+	for i, a := range in {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if alias, ok := archAliases[a]; ok {
+			a = alias
+		}
+		out[i] = a
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/errs"
+	"github.com/MrSnakeDoc/keg/internal/install"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/upgrade"
+
+	"github.com/spf13/cobra"
+)
+
+func NewPlanCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show what install and upgrade would change",
+		Long: `Show the taps, installs, upgrades, pins, hooks and links 'keg install'
+followed by 'keg upgrade' would run, without running them. Only read-only
+brew commands are run to compare keg.yml with this machine.
+
+Any command that changes the machine also accepts --dry-run to print its
+own plan instead.
+
+Examples:
+  keg plan                            # Plan for keg.yml
+  keg plan --manifest ../team/keg.yml # Review someone else's keg.yml first
+  keg plan --group k8s                # Only the packages of the k8s group
+  keg delete bat --remove --dry-run   # Plan of another command`,
+		Args:        cobra.NoArgs,
+		Annotations: dryRunnable,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			all, err := cmd.Flags().GetBool("all")
+			if err != nil {
+				return err
+			}
+			groups, err := cmd.Flags().GetStringSlice("group")
+			if err != nil {
+				return err
+			}
+			if all && len(groups) > 0 {
+				return middleware.FlagComboError(errs.AllWithGroup, "Plan", "plan")
+			}
+
+			// The plan itself is printed once the command is done (see root)
+			runner.FlagDryRun = true
+			if logger.LevelFromFlags() == "info" {
+				logger.SetLevel("warn")
+			}
+
+			if err := install.New(cfg, nil).Execute(nil, all, false, false, "", groups, false); err != nil {
+				return err
+			}
+			return upgrade.New(cfg, nil).Execute(nil, false, false, groups)
+		},
+	}
+
+	cmd.Flags().BoolP("all", "a", false, "Include optional packages")
+	cmd.Flags().StringSliceP("group", "g", nil, "Only plan for the packages of these groups")
+
+	return cmd
+}
@@ -0,0 +1,245 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/MrSnakeDoc/keg/internal/brew"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/printer"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+type Action string
+
+const (
+	Install   Action = "install"
+	Upgrade   Action = "upgrade"
+	Uninstall Action = "uninstall"
+	Tap       Action = "tap"
+	Pin       Action = "pin"
+	Link      Action = "link"
+	Hook      Action = "hook"
+	Run       Action = "run"
+)
+
+// Change is one thing a command would do to the machine.
+type Change struct {
+	Action Action
+	Name   string
+	// Detail completes Name: brew flags, versions, link source, hook command.
+	Detail string
+}
+
+// Edit is a file a command would rewrite: keg.yml or keg.lock.
+type Edit struct {
+	Path   string
+	Before []byte
+	After  []byte
+}
+
+// Plan collects what a --dry-run run would change besides brew commands,
+// which the shared runner.DryRunner records.
+type Plan struct {
+	mu      sync.Mutex
+	changes []Change
+	edits   []*Edit
+}
+
+var current = &Plan{}
+
+// Record adds c to the plan of this run.
+func Record(c Change) {
+	current.Record(c)
+}
+
+// RecordEdit adds the rewrite of path with data to the plan of this run.
+func RecordEdit(path string, data []byte) {
+	current.RecordEdit(path, data)
+}
+
+// Print writes the plan of this run to stdout: the commands the shared
+// runner.DryRunner skipped, then what was recorded here. Without a brew
+// state (say, deploy before Homebrew is installed) upgrades show no versions.
+func Print() error {
+	st, err := brew.FetchState(runner.New())
+	if err != nil {
+		logger.Debug("plan: failed to load brew state: %v", err)
+	}
+	return current.Write(os.Stdout, runner.Recorded(), st)
+}
+
+func (p *Plan) Record(c Change) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = append(p.changes, c)
+}
+
+// RecordEdit keeps the content path had before the first rewrite and the
+// last content written, so several saves of keg.yml make a single diff.
+func (p *Plan) RecordEdit(path string, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.edits {
+		if e.Path == path {
+			e.After = data
+			return
+		}
+	}
+	before, _ := os.ReadFile(path)
+	p.edits = append(p.edits, &Edit{Path: path, Before: before, After: data})
+}
+
+// Write renders the plan terraform-style: one line per change, the diff of
+// each edited file, and a summary. st gives the versions of upgrades.
+func (p *Plan) Write(w io.Writer, cmds []runner.Command, st *brew.BrewState) error {
+	p.mu.Lock()
+	changes := append(FromCommands(cmds, st), p.changes...)
+	edits := p.edits
+	p.mu.Unlock()
+
+	var b strings.Builder
+	if len(changes) == 0 && len(edits) == 0 {
+		b.WriteString("No changes. This machine already matches keg.yml.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	pr := printer.NewColorPrinter()
+	b.WriteString("keg would perform the following actions:\n\n")
+	counts := map[Action]int{}
+	for _, c := range changes {
+		counts[c.Action]++
+		line := fmt.Sprintf("%s %s", c.Action, c.Name)
+		if c.Detail != "" {
+			line += " (" + c.Detail + ")"
+		}
+		fmt.Fprintf(&b, "  %s %s\n", symbol(pr, c.Action), line)
+	}
+	for _, e := range edits {
+		fmt.Fprintf(&b, "\n  %s %s\n", pr.Warning("~"), e.Path)
+		for _, l := range Diff(string(e.Before), string(e.After)) {
+			switch l[0] {
+			case '+':
+				l = pr.Success(l)
+			case '-':
+				l = pr.Error(l)
+			}
+			fmt.Fprintf(&b, "      %s\n", l)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nPlan: %d to install, %d to upgrade, %d to uninstall",
+		counts[Install], counts[Upgrade], counts[Uninstall])
+	if len(edits) > 0 {
+		fmt.Fprintf(&b, ", %d file(s) to edit", len(edits))
+	}
+	b.WriteString(".\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func symbol(pr *printer.ColorPrinter, a Action) string {
+	switch a {
+	case Install, Tap, Link:
+		return pr.Success("+")
+	case Upgrade, Pin:
+		return pr.Warning("~")
+	case Uninstall:
+		return pr.Error("-")
+	default:
+		return pr.Info(">")
+	}
+}
+
+// FromCommands turns the commands a DryRunner recorded into changes.
+func FromCommands(cmds []runner.Command, st *brew.BrewState) []Change {
+	out := make([]Change, 0, len(cmds))
+	for _, c := range cmds {
+		out = append(out, fromCommand(c, st))
+	}
+	return out
+}
+
+func fromCommand(c runner.Command, st *brew.BrewState) Change {
+	if c.Name == "sh" && len(c.Args) == 2 && c.Args[0] == "-c" {
+		if pkg, stage := envValue(c.Env, "KEG_PACKAGE"), envValue(c.Env, "KEG_HOOK"); stage != "" {
+			return Change{Action: Hook, Name: stage + " of " + pkg, Detail: c.Args[1]}
+		}
+	}
+	if c.Name != "brew" || len(c.Args) < 2 {
+		return Change{Action: Run, Name: strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))}
+	}
+
+	action, name := Action(c.Args[0]), c.Args[len(c.Args)-1]
+	detail := strings.Join(c.Args[1:len(c.Args)-1], " ")
+	switch action {
+	case Upgrade:
+		if st == nil {
+			break
+		}
+		if info, ok := st.Outdated[path.Base(name)]; ok {
+			detail = strings.TrimSpace(fmt.Sprintf("%s -> %s %s", info.InstalledVersion, info.LatestVersion, detail))
+		}
+	case Install, Uninstall, Tap, Pin:
+	default:
+		return Change{Action: Run, Name: "brew " + strings.Join(c.Args, " ")}
+	}
+	return Change{Action: action, Name: name, Detail: detail}
+}
+
+func envValue(env []string, key string) string {
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, key+"="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// Diff returns the lines that differ between before and after, prefixed
+// with "- " or "+ ", in the order of a longest-common-subsequence diff.
+func Diff(before, after string) []string {
+	a := strings.Split(strings.TrimSuffix(before, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(after, "\n"), "\n")
+	if before == "" {
+		a = nil
+	}
+
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	return out
+}
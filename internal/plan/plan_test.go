@@ -0,0 +1,95 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/brew"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+func TestFromCommands(t *testing.T) {
+	cmds := []runner.Command{
+		{Name: "brew", Args: []string{"tap", "owner/tools"}},
+		{Name: "brew", Args: []string{"install", "--HEAD", "neovim"}},
+		{Name: "brew", Args: []string{"upgrade", "owner/tools/lazygit"}},
+		{Name: "brew", Args: []string{"uninstall", "htop"}},
+		{Name: "sh", Args: []string{"-c", "bat cache --build"}, Env: []string{"KEG_PACKAGE=bat", "KEG_HOOK=post_install"}},
+		{Name: "bash", Args: []string{"-c", "install.sh"}},
+	}
+	st := &brew.BrewState{Outdated: map[string]brew.PackageInfo{
+		"lazygit": {Name: "lazygit", InstalledVersion: "0.40.0", LatestVersion: "0.41.0"},
+	}}
+
+	want := []Change{
+		{Action: Tap, Name: "owner/tools"},
+		{Action: Install, Name: "neovim", Detail: "--HEAD"},
+		{Action: Upgrade, Name: "owner/tools/lazygit", Detail: "0.40.0 -> 0.41.0"},
+		{Action: Uninstall, Name: "htop"},
+		{Action: Hook, Name: "post_install of bat", Detail: "bat cache --build"},
+		{Action: Run, Name: "bash -c install.sh"},
+	}
+	got := FromCommands(cmds, st)
+	if len(got) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("change %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := "packages:\n  - command: bat\n  - command: fzf\n"
+	after := "packages:\n  - command: bat\n  - command: jq\n"
+
+	got := strings.Join(Diff(before, after), "\n")
+	if want := "-   - command: fzf\n+   - command: jq"; got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if d := Diff(before, before); len(d) != 0 {
+		t.Fatalf("expected no diff, got %v", d)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keg.yml")
+	if err := os.WriteFile(path, []byte("packages: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Plan{}
+	p.RecordEdit(path, []byte("packages:\n  - command: bat\n"))
+	p.RecordEdit(path, []byte("packages:\n  - command: jq\n"))
+	p.Record(Change{Action: Link, Name: "/home/me/.batrc", Detail: "/dotfiles/batrc"})
+
+	var b strings.Builder
+	cmds := []runner.Command{{Name: "brew", Args: []string{"install", "jq"}}}
+	if err := p.Write(&b, cmds, nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"+ install jq\n",
+		"+ link /home/me/.batrc (/dotfiles/batrc)\n",
+		"~ " + path,
+		"- packages: []",
+		"+   - command: jq",
+		"Plan: 1 to install, 0 to upgrade, 0 to uninstall, 1 file(s) to edit.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "command: bat") {
+		t.Errorf("only the last save of a file counts:\n%s", out)
+	}
+
+	b.Reset()
+	if err := (&Plan{}).Write(&b, nil, nil); err != nil || !strings.HasPrefix(b.String(), "No changes.") {
+		t.Fatalf("expected no changes, got %q, %v", b.String(), err)
+	}
+}
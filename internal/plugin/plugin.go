@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MrSnakeDoc/keg/internal/checker"
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+const (
+	// Prefix of plugin executables: `keg foo` runs `keg-foo`.
+	Prefix = "keg-"
+	// Dir holds plugins that are not on PATH, relative to the home directory.
+	Dir = ".config/keg/plugins"
+	// ContextEnv is the variable carrying the JSON Context to a plugin.
+	ContextEnv = "KEG_PLUGIN_CONTEXT"
+	// APIVersion is bumped whenever Context changes in a breaking way.
+	APIVersion = 1
+)
+
+// runTimeout only exists because runners need a bound: plugins may be
+// interactive or long-lived (watchers, shells).
+const runTimeout = 24 * time.Hour
+
+// Context describes the running keg to a plugin. Manifest fields are empty
+// when keg has no manifest to offer (no `keg init` yet, for instance).
+type Context struct {
+	APIVersion int    `json:"api_version"`
+	KegVersion string `json:"keg_version"`
+	Plugin     string `json:"plugin"`
+	// Manifest is the keg.yml keg edits; Manifests adds the other manifests
+	// of the profile, merged below it.
+	Manifest   string   `json:"manifest,omitempty"`
+	Manifests  []string `json:"manifests,omitempty"`
+	Profile    string   `json:"profile,omitempty"`
+	ConfigDir  string   `json:"config_dir"`
+	StateDir   string   `json:"state_dir"`
+	PluginDir  string   `json:"plugin_dir"`
+	BrewPrefix string   `json:"brew_prefix"`
+	// LogLevel is "debug", "info", "error" or "silent".
+	LogLevel string `json:"log_level"`
+	LogJSON  bool   `json:"log_json"`
+}
+
+// ExitError reports a plugin that exited with a non-zero status. keg exits
+// with the same code, leaving the error reporting to the plugin.
+type ExitError struct {
+	Name string
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("plugin %s exited with status %d", e.Name, e.Code)
+}
+
+// Find returns the executable behind `keg name`: keg-name in Dir, then on
+// PATH.
+func Find(name string) (string, bool) {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	file := Prefix + name
+
+	if path := filepath.Join(globalconfig.GetConfigDir(Dir), file); isExecutable(path) {
+		return path, true
+	}
+	if path, err := exec.LookPath(file); err == nil {
+		return path, true
+	}
+	return "", false
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0
+}
+
+// NewContext builds the Context of plugin name. The manifests are resolved
+// the way any command resolves them (--manifest, --profile, project keg.yml…).
+func NewContext(name string) Context {
+	c := Context{
+		APIVersion: APIVersion,
+		KegVersion: checker.Version,
+		Plugin:     name,
+		ConfigDir:  globalconfig.Dir(),
+		StateDir:   globalconfig.GetConfigDir(utils.CacheDir),
+		PluginDir:  globalconfig.GetConfigDir(Dir),
+		BrewPrefix: utils.HomebrewPrefix(),
+		LogLevel:   logger.LevelFromFlags(),
+		LogJSON:    logger.FlagJSON,
+	}
+
+	cfg, err := globalconfig.LoadPersistentConfig()
+	if err != nil {
+		logger.Debug("no manifest for plugin %s: %v", name, err)
+		return c
+	}
+	if m := cfg.Manifest(); m != "" {
+		c.Manifest = m
+		c.Manifests = cfg.Manifests
+		c.Profile = cfg.Profile
+	}
+	return c
+}
+
+// Run executes the plugin at path with args and keg's standard streams. The
+// Context is passed as JSON in $KEG_PLUGIN_CONTEXT, which leaves stdin to
+// interactive plugins.
+func Run(r runner.CommandRunner, path string, c Context, args []string) error {
+	if r == nil {
+		r = &runner.ExecRunner{}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin context: %w", err)
+	}
+	env := []string{ContextEnv + "=" + string(data)}
+	// Lets the plugin call keg back on the same manifest
+	if globalconfig.FlagManifest != "" && c.Manifest != "" {
+		env = append(env, globalconfig.ManifestEnv+"="+c.Manifest)
+	}
+
+	logger.Debug("running plugin %s: %s %s", c.Plugin, path, strings.Join(args, " "))
+	ctx := runner.WithEnv(context.Background(), env)
+	if _, err := r.Run(ctx, runTimeout, runner.Stream, path, args...); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return &ExitError{Name: c.Plugin, Code: exitErr.ExitCode()}
+		}
+		return fmt.Errorf("failed to run plugin %s: %w", c.Plugin, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFind(t *testing.T) {
+	home := t.TempDir()
+	bin := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", bin)
+
+	local := writeScript(t, filepath.Join(home, Dir), "keg-both", "true")
+	writeScript(t, bin, "keg-both", "true")
+	onPath := writeScript(t, bin, "keg-path", "true")
+	if err := os.WriteFile(filepath.Join(home, Dir, "keg-noexec"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"both", local, true},
+		{"path", onPath, true},
+		{"noexec", "", false},
+		{"missing", "", false},
+		{"../keg-path", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := Find(tt.name)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Find(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRun_PassesContext(t *testing.T) {
+	mr := runner.NewMockRunner()
+	c := Context{APIVersion: APIVersion, Plugin: "hello", Manifest: "/tmp/keg.yml", LogLevel: "info"}
+
+	if err := Run(mr, "/plugins/keg-hello", c, []string{"--flag", "arg"}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(mr.Commands) != 1 {
+		t.Fatalf("expected one command, got %+v", mr.Commands)
+	}
+	cmd := mr.Commands[0]
+	if cmd.Name != "/plugins/keg-hello" || strings.Join(cmd.Args, " ") != "--flag arg" || cmd.Mode != runner.Stream {
+		t.Fatalf("unexpected command: %+v", cmd)
+	}
+
+	var got Context
+	for _, kv := range cmd.Env {
+		if v, ok := strings.CutPrefix(kv, ContextEnv+"="); ok {
+			if err := json.Unmarshal([]byte(v), &got); err != nil {
+				t.Fatalf("invalid context: %v", err)
+			}
+		}
+	}
+	if got.Plugin != "hello" || got.Manifest != "/tmp/keg.yml" || got.APIVersion != APIVersion {
+		t.Fatalf("unexpected context: %+v", got)
+	}
+}
+
+func TestRun_ExitCode(t *testing.T) {
+	path := writeScript(t, t.TempDir(), "keg-fail", "exit 3")
+
+	err := Run(nil, path, Context{Plugin: "fail"}, nil)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("expected exit status 3, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/profile"
+
+	"github.com/spf13/cobra"
+)
+
+func NewProfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage named sets of manifests",
+		Long: `Manage profiles: named sets of manifests stored in ~/.config/keg/config.yml.
+
+The first manifest of a profile is the keg.yml that 'install --add' and
+'delete --remove' edit; the others are merged below it like includes.
+The keg.yml set up by 'keg init' is the "default" profile.
+
+Use --profile on any command to pick a profile for that run only.
+
+Examples:
+  keg profile add work ~/work/keg.yml ~/dotfiles/base.yml
+  keg profile use work
+  keg profile list
+  keg install --profile personal`,
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the profiles and their manifests",
+			Args:  cobra.NoArgs,
+			RunE: func(_ *cobra.Command, _ []string) error {
+				return profile.New().List()
+			},
+		},
+		&cobra.Command{
+			Use:   "use <name>",
+			Short: "Switch to a profile",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(_ *cobra.Command, args []string) error {
+				return profile.New().Use(args[0])
+			},
+		},
+		&cobra.Command{
+			Use:   "add <name> <manifest> [manifests...]",
+			Short: "Create or replace a profile",
+			Args:  cobra.MinimumNArgs(2),
+			RunE: func(_ *cobra.Command, args []string) error {
+				return profile.New().Add(args[0], args[1:])
+			},
+		},
+	)
+	return cmd
+}
@@ -0,0 +1,137 @@
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/printer"
+)
+
+type Manager struct{}
+
+func New() *Manager {
+	return &Manager{}
+}
+
+// Add creates or replaces a profile. The first manifest is the one keg
+// edits; the others are merged below it.
+func (*Manager) Add(name string, manifests []string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(manifests))
+	for _, m := range manifests {
+		p, err := globalconfig.AbsManifest(m)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+	}
+
+	cfg, err := globalconfig.ReadPersistentConfig()
+	if err != nil {
+		return err
+	}
+	_, exists := cfg.Profiles[name]
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]globalconfig.Profile)
+	}
+	cfg.Profiles[name] = globalconfig.Profile{Manifests: paths}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	if exists {
+		logger.Success("Updated profile %s", name)
+	} else {
+		logger.Success("Added profile %s, run 'keg profile use %s' to switch to it", name, name)
+	}
+	return nil
+}
+
+// Use makes name the active profile. DefaultProfile goes back to the
+// keg.yml set up by `keg init`.
+func (*Manager) Use(name string) error {
+	cfg, err := globalconfig.ReadPersistentConfig()
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.ProfileManifests(name); err != nil {
+		return err
+	}
+
+	cfg.ActiveProfile = name
+	if name == globalconfig.DefaultProfile {
+		cfg.ActiveProfile = ""
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	logger.Success("Using profile %s", name)
+	return nil
+}
+
+// List prints the configured profiles and their manifests.
+func (*Manager) List() error {
+	cfg, err := globalconfig.ReadPersistentConfig()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Profiles)+1)
+	if cfg.PackagesFile != "" {
+		names = append(names, globalconfig.DefaultProfile)
+	}
+	custom := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		custom = append(custom, name)
+	}
+	sort.Strings(custom)
+	names = append(names, custom...)
+
+	if len(names) == 0 {
+		logger.Info("No profile configured, run 'keg init' or 'keg profile add'")
+		return nil
+	}
+
+	active := cfg.ActiveProfile
+	if active == "" {
+		active = globalconfig.DefaultProfile
+	}
+
+	p := printer.NewColorPrinter()
+	table := logger.CreateTable([]string{"Profile", "Manifests", "Status"})
+	for _, name := range names {
+		manifests, err := cfg.ProfileManifests(name)
+		if err != nil {
+			return err
+		}
+		status := ""
+		if name == active {
+			status = p.Success("active")
+		}
+		if err := table.Append([]string{name, strings.Join(manifests, ", "), status}); err != nil {
+			return fmt.Errorf("append to table: %w", err)
+		}
+	}
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("render table: %w", err)
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("profile name cannot be empty")
+	case name == globalconfig.DefaultProfile:
+		return fmt.Errorf("%q is reserved for the keg.yml set up by 'keg init'", name)
+	case strings.ContainsAny(name, " \t/"):
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+// setupHome points HOME at a temp dir holding a default keg.yml and two
+// manifests for profiles.
+func setupHome(t *testing.T) (home string, work, base string) {
+	t.Helper()
+	home = t.TempDir()
+	t.Setenv("HOME", home)
+
+	for _, name := range []string{"keg.yml", "work.yml", "base.yml"} {
+		if err := os.WriteFile(filepath.Join(home, name), []byte("packages: []\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &globalconfig.PersistentConfig{PackagesFile: filepath.Join(home, "keg.yml")}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return home, filepath.Join(home, "work.yml"), filepath.Join(home, "base.yml")
+}
+
+func TestAddAndUse(t *testing.T) {
+	home, work, base := setupHome(t)
+	m := New()
+
+	if err := m.Add("work", []string{work, base}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	// Adding a profile does not switch to it
+	cfg, err := globalconfig.LoadPersistentConfig()
+	if err != nil {
+		t.Fatalf("LoadPersistentConfig: %v", err)
+	}
+	if cfg.Profile != globalconfig.DefaultProfile || cfg.Manifest() != filepath.Join(home, "keg.yml") {
+		t.Fatalf("expected the default profile, got %s (%v)", cfg.Profile, cfg.Manifests)
+	}
+
+	if err := m.Use("work"); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	cfg, err = globalconfig.LoadPersistentConfig()
+	if err != nil {
+		t.Fatalf("LoadPersistentConfig: %v", err)
+	}
+	if cfg.Profile != "work" || !reflect.DeepEqual(cfg.Manifests, []string{work, base}) {
+		t.Fatalf("expected the work profile, got %s (%v)", cfg.Profile, cfg.Manifests)
+	}
+
+	// Stored paths stay in ~ form, packages_file included
+	data, err := os.ReadFile(filepath.Join(home, ".config/keg/config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), home) {
+		t.Fatalf("expected home-relative paths, got:\n%s", data)
+	}
+
+	if err := m.Use(globalconfig.DefaultProfile); err != nil {
+		t.Fatalf("Use default: %v", err)
+	}
+	if cfg, _ = globalconfig.LoadPersistentConfig(); cfg.Profile != globalconfig.DefaultProfile {
+		t.Fatalf("expected to be back on the default profile, got %s", cfg.Profile)
+	}
+}
+
+func TestFlagProfileOverridesActive(t *testing.T) {
+	_, work, _ := setupHome(t)
+	if err := New().Add("ci", []string{work}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	globalconfig.FlagProfile = "ci"
+	defer func() { globalconfig.FlagProfile = "" }()
+
+	cfg, err := globalconfig.LoadPersistentConfig()
+	if err != nil {
+		t.Fatalf("LoadPersistentConfig: %v", err)
+	}
+	if cfg.Profile != "ci" || cfg.Manifest() != work {
+		t.Fatalf("expected --profile to win, got %s (%v)", cfg.Profile, cfg.Manifests)
+	}
+
+	globalconfig.FlagProfile = "nope"
+	if _, err := globalconfig.LoadPersistentConfig(); err == nil || !strings.Contains(err.Error(), `unknown profile "nope"`) {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestAdd_Errors(t *testing.T) {
+	home, _, _ := setupHome(t)
+	m := New()
+
+	tests := []struct {
+		name      string
+		profile   string
+		manifests []string
+		wantErr   string
+	}{
+		{"reserved name", globalconfig.DefaultProfile, []string{filepath.Join(home, "keg.yml")}, "reserved"},
+		{"invalid name", "my work", []string{filepath.Join(home, "keg.yml")}, "invalid profile name"},
+		{"missing manifest", "work", []string{filepath.Join(home, "missing.yml")}, "packages file not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Add(tt.profile, tt.manifests); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := m.Use("work"); err == nil {
+		t.Fatalf("expected Use to refuse an unknown profile")
+	}
+}
@@ -9,14 +9,24 @@ import (
 	"strings"
 
 	"github.com/MrSnakeDoc/keg/internal/checker"
+	"github.com/MrSnakeDoc/keg/internal/core"
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
 	"github.com/MrSnakeDoc/keg/internal/logger"
 	"github.com/MrSnakeDoc/keg/internal/middleware"
 	"github.com/MrSnakeDoc/keg/internal/notifier"
+	"github.com/MrSnakeDoc/keg/internal/plan"
+	"github.com/MrSnakeDoc/keg/internal/plugin"
+	"github.com/MrSnakeDoc/keg/internal/runner"
 	"github.com/MrSnakeDoc/keg/internal/utils"
 
 	"github.com/spf13/cobra"
 )
 
+// dryRunnable annotates the commands that support --dry-run: they act
+// through runner.New and record the files they would write in the plan
+// (globalconfig.SaveConfig does it for keg.yml).
+var dryRunnable = map[string]string{"keg/dry-run": "true"}
+
 func NewRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "keg",
@@ -26,18 +36,36 @@ It allows you to easily install, update, and manage packages and dependencies fo
 		Example:       `keg install lazygit asdf`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
+		// Unknown commands go through runPlugin, which suggests like cobra does
+		SuggestionsMinimumDistance: 2,
 		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
 			logger.ConfigureLoggerFromFlags()
+			if runner.FlagDryRun && !supportsDryRun(cmd) {
+				return fmt.Errorf("--dry-run is not supported by %s", cmd.CommandPath())
+			}
+			if core.FlagJobs < 1 {
+				return fmt.Errorf("--jobs must be at least 1, got %d", core.FlagJobs)
+			}
 			return nil
 		},
-		Run: func(cmd *cobra.Command, _ []string) {
+		// Anything that is not a subcommand may be a plugin (keg-<name>)
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
 			versionFlag, _ := cmd.Flags().GetBool("version")
 			if versionFlag {
 				checker.PrintVersion()
-				return
+				return nil
 			}
+			if len(args) > 0 {
+				return runPlugin(cmd, args)
+			}
+			return nil
 		},
-		PersistentPostRunE: func(cmd *cobra.Command, _ []string) error {
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			if runner.FlagDryRun && supportsDryRun(cmd) {
+				return plan.Print()
+			}
+
 			noUpdate, _ := cmd.Flags().GetBool("no-update-check")
 
 			envNoUpdate := strings.TrimSpace(os.Getenv("KEG_NO_UPDATE_CHECK")) == "1"
@@ -50,7 +78,9 @@ It allows you to easily install, update, and manage packages and dependencies fo
 			case name == "update",
 				name == "help",
 				name == "completion",
-				name == "keg" && v,
+				name == "shellenv",
+				cmd.HasParent() && cmd.Parent().Name() == "export",
+				name == "keg" && (v || len(args) > 0),
 				envNoUpdate || noUpdate:
 				return nil
 			}
@@ -81,17 +111,42 @@ It allows you to easily install, update, and manage packages and dependencies fo
 	})
 
 	cmd.Flags().BoolP("version", "v", false, "Print version information")
+	// Flags after a plugin name belong to the plugin
+	cmd.Flags().SetInterspersed(false)
 	cmd.PersistentFlags().Bool("no-update-check", false, "Skip update check")
 	cmd.PersistentFlags().CountVarP(&logger.FlagVerboseCount, "verbose", "V", "Increase verbosity (-V, -VV, -VVV)")
 	cmd.PersistentFlags().BoolVarP(&logger.FlagSilent, "silent", "s", false, "Silent mode (no output even errors)")
 	cmd.PersistentFlags().BoolVarP(&logger.FlagQuiet, "quiet", "q", false, "Quiet mode (no log output except errors)")
 	cmd.PersistentFlags().BoolVarP(&logger.FlagJSON, "log-json", "j", false, "Log in JSON (no colors)")
+	cmd.PersistentFlags().StringVar(&globalconfig.FlagProfile, "profile", "", "Use this profile instead of the active one")
+	cmd.PersistentFlags().BoolVar(&runner.FlagDryRun, "dry-run", false, "Print what would change instead of changing it")
+	cmd.PersistentFlags().IntVar(&core.FlagJobs, "jobs", 1, "Download up to this many packages at once")
+	cmd.PersistentFlags().BoolVar(&core.FlagKeepGoing, "keep-going", false, "Carry on after a package fails and summarize at the end")
+	cmd.PersistentFlags().StringVar(&globalconfig.FlagManifest, "manifest", "", "Use this keg.yml instead of the configured one (or set KEG_MANIFEST)")
 
 	RegisterSubCommands(cmd)
 
 	return cmd
 }
 
+func supportsDryRun(cmd *cobra.Command) bool {
+	return cmd.Annotations["keg/dry-run"] != ""
+}
+
+// runPlugin hands `keg name args...` over to the keg-name plugin.
+func runPlugin(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	path, ok := plugin.Find(name)
+	if !ok {
+		msg := fmt.Sprintf("unknown command %q for %q", name, cmd.CommandPath())
+		if suggestions := cmd.SuggestionsFor(name); len(suggestions) > 0 {
+			msg += "\n\nDid you mean this?\n\t" + strings.Join(suggestions, "\n\t")
+		}
+		return errors.New(msg)
+	}
+	return plugin.Run(nil, path, plugin.NewContext(name), args[1:])
+}
+
 func Execute() error {
 	root := NewRootCmd()
 
@@ -103,6 +158,11 @@ func Execute() error {
 		if errors.Is(err, middleware.ErrLogged) {
 			os.Exit(1)
 		}
+		var pluginErr *plugin.ExitError
+		if errors.As(err, &pluginErr) {
+			logger.Debug("%v", err)
+			os.Exit(pluginErr.Code)
+		}
 		return err
 	}
 	return nil
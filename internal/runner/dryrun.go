@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FlagDryRun is the global --dry-run flag: commands built with New record
+// what they would change instead of changing it.
+var FlagDryRun bool
+
+// Command is a command a DryRunner did not run.
+type Command struct {
+	Name string
+	Args []string
+	Env  []string
+}
+
+// readOnly lists the brew subcommands that only read brew's state; a
+// DryRunner runs them so the plan is computed against the real machine.
+var readOnly = map[string]bool{
+	"list":         true,
+	"info":         true,
+	"outdated":     true,
+	"leaves":       true,
+	"deps":         true,
+	"uses":         true,
+	"search":       true,
+	"desc":         true,
+	"config":       true,
+	"--prefix":     true,
+	"--version":    true,
+	"--cellar":     true,
+	"tap-info":     true,
+	"--repository": true,
+}
+
+// DryRunner runs read-only brew commands with Inner and records every
+// other command (installs, taps, pins, hooks...) as if it had succeeded.
+type DryRunner struct {
+	Inner CommandRunner
+
+	mu       sync.Mutex
+	commands []Command
+}
+
+var dryRun = &DryRunner{Inner: ExecRunner{}}
+
+// New returns the runner commands act through: the shared DryRunner with
+// --dry-run, an ExecRunner otherwise.
+func New() CommandRunner {
+	if FlagDryRun {
+		return dryRun
+	}
+	return &ExecRunner{}
+}
+
+// Recorded returns the commands the shared DryRunner skipped so far.
+func Recorded() []Command {
+	return dryRun.Commands()
+}
+
+// IsDryRun reports whether r only records what it is asked to run.
+func IsDryRun(r CommandRunner) bool {
+	_, ok := r.(*DryRunner)
+	return ok
+}
+
+func (d *DryRunner) Run(
+	ctx context.Context,
+	timeout time.Duration,
+	mode Mode,
+	name string,
+	args ...string,
+) ([]byte, error) {
+	if name == "brew" && (len(args) == 0 || readOnly[args[0]] || (args[0] == "tap" && len(args) == 1)) {
+		return d.Inner.Run(ctx, timeout, mode, name, args...)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.commands = append(d.commands, Command{
+		Name: name,
+		Args: append([]string(nil), args...),
+		Env:  EnvFrom(ctx),
+	})
+	if mode == Stream {
+		return nil, nil
+	}
+	return []byte{}, nil
+}
+
+// Commands returns the commands recorded so far, in order.
+func (d *DryRunner) Commands() []Command {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Command(nil), d.commands...)
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"sync"
 	"time"
 )
 
+// MockRunner records the commands it is given instead of running them. Run
+// may be called from several goroutines.
 type MockRunner struct {
+	mu           sync.Mutex
 	Commands     []MockCommand
 	Responses    map[string]MockResponse
 	ResponseFunc func(name string, args ...string) ([]byte, error)
@@ -41,15 +45,18 @@ func (m *MockRunner) Run(
 	name string,
 	args ...string,
 ) ([]byte, error) {
+	m.mu.Lock()
 	m.Commands = append(m.Commands, MockCommand{
 		Name:    name,
 		Args:    args,
+		Env:     EnvFrom(ctx),
 		Timeout: timeout,
 		Mode:    mode,
 	})
+	resp, ok := m.Responses[cmdKey(name, args...)]
+	m.mu.Unlock()
 
-	key := cmdKey(name, args...)
-	if resp, ok := m.Responses[key]; ok {
+	if ok {
 		return resp.Output, resp.Error
 	}
 	if m.ResponseFunc != nil {
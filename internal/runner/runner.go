@@ -19,6 +19,26 @@ type CommandRunner interface {
 		name string, args ...string) ([]byte, error)
 }
 
+type envKey struct{}
+
+// WithEnv returns a context whose commands run with env ("KEY=value")
+// added to the environment of keg.
+func WithEnv(ctx context.Context, env []string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, envKey{}, append(EnvFrom(ctx), env...))
+}
+
+// EnvFrom returns the variables added to ctx with WithEnv.
+func EnvFrom(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	env, _ := ctx.Value(envKey{}).([]string)
+	return append([]string(nil), env...)
+}
+
 type ExecRunner struct{}
 
 func (ExecRunner) Run(
@@ -32,6 +52,9 @@ func (ExecRunner) Run(
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, name, args...)
+	if env := EnvFrom(parent); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	switch mode {
 	case Stream:
@@ -83,6 +83,12 @@ type AdvancedFetcher interface {
 	FetchWithETag(ctx context.Context, url, prevETag string, maxBytes int64) (FetchResult, error)
 }
 
+// TextFetcher fetches plain-text documents (YAML manifests on GitHub raw,
+// Gists, S3...) with the same ETag semantics as AdvancedFetcher.
+type TextFetcher interface {
+	FetchTextWithETag(ctx context.Context, url, prevETag string, maxBytes int64) (FetchResult, error)
+}
+
 type AdvancedHTTPClient struct {
 	hc *http.Client
 	ua string
@@ -130,9 +136,20 @@ type FetchResult struct {
 }
 
 func (c *AdvancedHTTPClient) FetchWithETag(ctx context.Context, url, prevETag string, maxBytes int64) (FetchResult, error) {
+	return c.fetch(ctx, url, prevETag, "application/json", maxBytes, isJSON)
+}
+
+// FetchTextWithETag is FetchWithETag for text payloads: it accepts YAML,
+// text/* and octet-stream responses instead of requiring JSON.
+// The body may still be gzip-encoded (see utils.MaybeGunzip).
+func (c *AdvancedHTTPClient) FetchTextWithETag(ctx context.Context, url, prevETag string, maxBytes int64) (FetchResult, error) {
+	return c.fetch(ctx, url, prevETag, "application/yaml, text/plain;q=0.9, */*;q=0.5", maxBytes, isText)
+}
+
+func (c *AdvancedHTTPClient) fetch(ctx context.Context, url, prevETag, accept string, maxBytes int64, acceptCT func(string) bool) (FetchResult, error) {
 	ctx, cancel := context.WithTimeout(ctx, globalconfig.RequestDeadline)
 
-	req, err := c.prepareRequest(ctx, url, prevETag)
+	req, err := c.prepareRequest(ctx, url, prevETag, accept)
 	if err != nil {
 		cancel()
 		return FetchResult{}, fmt.Errorf("prepare request: %w", err)
@@ -144,16 +161,16 @@ func (c *AdvancedHTTPClient) FetchWithETag(ctx context.Context, url, prevETag st
 		return FetchResult{}, classifyNetErr(err)
 	}
 
-	return handleResponse(resp, maxBytes, cancel)
+	return handleResponse(resp, maxBytes, cancel, acceptCT)
 }
 
-func (c *AdvancedHTTPClient) prepareRequest(ctx context.Context, url, prevETag string) (*http.Request, error) {
+func (c *AdvancedHTTPClient) prepareRequest(ctx context.Context, url, prevETag, accept string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", c.ua)
-	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept", accept)
 	req.Header.Set("Accept-Encoding", "gzip")
 	if prevETag != "" {
 		req.Header.Set("If-None-Match", prevETag)
@@ -161,7 +178,7 @@ func (c *AdvancedHTTPClient) prepareRequest(ctx context.Context, url, prevETag s
 	return req, nil
 }
 
-func handleResponse(resp *http.Response, maxBytes int64, cancel func()) (f FetchResult, err error) {
+func handleResponse(resp *http.Response, maxBytes int64, cancel func(), acceptCT func(string) bool) (f FetchResult, err error) {
 	if resp == nil {
 		cancel()
 		return FetchResult{}, fmt.Errorf("nil response")
@@ -187,7 +204,7 @@ func handleResponse(resp *http.Response, maxBytes int64, cancel func()) (f Fetch
 		return FetchResult{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
 	}
 
-	if !isJSON(resp.Header.Get("Content-Type")) {
+	if !acceptCT(resp.Header.Get("Content-Type")) {
 		cancel()
 		return FetchResult{}, fmt.Errorf("unexpected content-type %q", resp.Header.Get("Content-Type"))
 	}
@@ -227,6 +244,16 @@ func isJSON(ct string) bool {
 	return strings.HasPrefix(ct, "application/json")
 }
 
+func isText(ct string) bool {
+	if isJSON(ct) {
+		return true
+	}
+	ct = strings.ToLower(ct)
+	return strings.HasPrefix(ct, "text/") ||
+		strings.Contains(ct, "yaml") ||
+		strings.HasPrefix(ct, "application/octet-stream")
+}
+
 func headerETag(resp *http.Response) string { return resp.Header.Get("ETag") }
 
 func headerContentLength(resp *http.Response) int64 {
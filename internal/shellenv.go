@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/shellenv"
+
+	"github.com/spf13/cobra"
+)
+
+func NewShellenvCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shellenv [zsh|bash|fish]",
+		Short: "Print the shell setup for Homebrew and keg.yml",
+		Long: `Print a snippet that sets up Homebrew, the completions of installed
+formulae and the 'init:' lines of keg.yml for your shell. The shell
+defaults to the one in $SHELL.
+
+Add one of these lines to your shell configuration:
+  eval "$(keg shellenv zsh)"     # ~/.zshrc, before any compinit
+  eval "$(keg shellenv bash)"    # ~/.bashrc
+  keg shellenv fish | source     # ~/.config/fish/config.fish`,
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: shellenv.Shells,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			shell := ""
+			if len(args) == 1 {
+				shell = args[0]
+			} else if detected, ok := shellenv.DetectShell(); ok {
+				shell = detected
+			} else {
+				return fmt.Errorf("cannot tell the shell from $SHELL, pass one of: zsh, bash, fish")
+			}
+
+			return shellenv.New(cfg).Write(cmd.OutOrStdout(), shell)
+		},
+	}
+	return cmd
+}
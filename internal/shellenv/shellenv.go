@@ -0,0 +1,159 @@
+package shellenv
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+// Shells lists the shells a snippet can be written for.
+var Shells = []string{models.ShellZsh, models.ShellBash, models.ShellFish}
+
+type Generator struct {
+	Config *models.Config
+	Host   *models.Host
+	// Prefix is the Homebrew prefix the snippet points at.
+	Prefix string
+}
+
+func New(config *models.Config) *Generator {
+	return &Generator{
+		Config: config,
+		Host:   utils.CurrentHost(),
+		Prefix: utils.HomebrewPrefix(),
+	}
+}
+
+// DetectShell returns the shell named by $SHELL, if keg supports it.
+func DetectShell() (string, bool) {
+	name := filepath.Base(os.Getenv("SHELL"))
+	for _, s := range Shells {
+		if s == name {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// Write prints the snippet of shell: the Homebrew environment, the
+// completions installed formulae ship, and the `init:` lines of keg.yml.
+// It is meant to be evaluated on every shell start, so it never calls brew.
+func (g *Generator) Write(w io.Writer, shell string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by keg shellenv %s\n", shell)
+
+	switch shell {
+	case models.ShellZsh, models.ShellBash:
+		g.writePosix(&b, shell)
+	case models.ShellFish:
+		g.writeFish(&b)
+	default:
+		return fmt.Errorf("unsupported shell %q (supported: %s)", shell, strings.Join(Shells, ", "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g *Generator) writePosix(b *strings.Builder, shell string) {
+	for _, v := range utils.HomebrewEnv(g.Prefix) {
+		if !v.List {
+			fmt.Fprintf(b, "export %s=%s\n", v.Name, quote(v.Value))
+			continue
+		}
+		// An empty MANPATH/INFOPATH entry stands for the system defaults
+		rest := fmt.Sprintf(":${%s#:}", v.Name)
+		if v.Name == "PATH" {
+			rest = "${PATH:+:$PATH}"
+		}
+		fmt.Fprintf(b, "case \":${%s}:\" in *:%s:*) ;; *) export %s=\"%s%s\" ;; esac\n",
+			v.Name, quote(v.Value), v.Name, v.Value, rest)
+	}
+
+	b.WriteString("\n")
+	if shell == models.ShellZsh {
+		b.WriteString(`if [[ -d "$HOMEBREW_PREFIX/share/zsh/site-functions" ]]; then
+  fpath=("$HOMEBREW_PREFIX/share/zsh/site-functions" $fpath)
+fi
+(( $+functions[compdef] )) || { autoload -Uz compinit && compinit; }
+`)
+	} else {
+		b.WriteString(`if [[ -r "$HOMEBREW_PREFIX/etc/profile.d/bash_completion.sh" ]]; then
+  source "$HOMEBREW_PREFIX/etc/profile.d/bash_completion.sh"
+else
+  for completion in "$HOMEBREW_PREFIX/etc/bash_completion.d/"*; do
+    [[ -r "$completion" ]] && source "$completion"
+  done
+  unset completion
+fi
+`)
+	}
+
+	for _, p := range g.packages(shell) {
+		fmt.Fprintf(b, "\n# %s\nif command -v %s >/dev/null 2>&1; then\n", p.FormulaName(), quote(binary(p)))
+		for _, line := range p.Init.For(shell) {
+			fmt.Fprintf(b, "  %s\n", line)
+		}
+		b.WriteString("fi\n")
+	}
+}
+
+func (g *Generator) writeFish(b *strings.Builder) {
+	for _, v := range utils.HomebrewEnv(g.Prefix) {
+		if !v.List {
+			fmt.Fprintf(b, "set -gx %s %s\n", v.Name, quote(v.Value))
+			continue
+		}
+		if v.Name != "PATH" {
+			fmt.Fprintf(b, "set -q %s; or set -gx %s ''\n", v.Name, v.Name)
+		}
+		fmt.Fprintf(b, "contains %s $%s; or set -gx %s %s $%s\n", quote(v.Value), v.Name, v.Name, quote(v.Value), v.Name)
+	}
+
+	b.WriteString(`
+if test -d "$HOMEBREW_PREFIX/share/fish/vendor_completions.d"
+    contains "$HOMEBREW_PREFIX/share/fish/vendor_completions.d" $fish_complete_path
+    or set -gx fish_complete_path $fish_complete_path "$HOMEBREW_PREFIX/share/fish/vendor_completions.d"
+end
+`)
+
+	for _, p := range g.packages(models.ShellFish) {
+		fmt.Fprintf(b, "\n# %s\nif command -q %s\n", p.FormulaName(), quote(binary(p)))
+		for _, line := range p.Init.For(models.ShellFish) {
+			fmt.Fprintf(b, "    %s\n", line)
+		}
+		b.WriteString("end\n")
+	}
+}
+
+// packages returns the packages available on this host with init lines for
+// shell. Their lines are guarded by a check on the binary at runtime, so
+// packages that are not installed (yet) do not break the shell.
+func (g *Generator) packages(shell string) []*models.Package {
+	var out []*models.Package
+	for i := range g.Config.Packages {
+		p := &g.Config.Packages[i]
+		if len(p.Init.For(shell)) > 0 && p.AvailableOn(g.Host) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func binary(p *models.Package) string {
+	if p.Binary != "" {
+		return p.Binary
+	}
+	return p.FormulaName()
+}
+
+// quote wraps s in double quotes, which zsh, bash and fish all read the same
+// way for the paths and names keg writes.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(s) + `"`
+}
@@ -0,0 +1,90 @@
+package shellenv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+const manifest = `packages:
+  - command: zoxide
+    init: eval "$(zoxide init zsh)"
+  - command: starship
+    init:
+      fish: starship init fish | source
+  - command: ripgrep
+    binary: rg
+    init:
+      bash: [export RIPGREP_CONFIG_PATH=~/.ripgreprc]
+  - command: podman
+    init: eval "$(podman completion zsh)"
+    when:
+      os: darwin
+`
+
+func newTestGenerator(t *testing.T) *Generator {
+	t.Helper()
+	var cfg models.Config
+	if err := yaml.Unmarshal([]byte(manifest), &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return &Generator{Config: &cfg, Host: &models.Host{OS: "linux", Arch: "amd64"}, Prefix: "/opt/brew"}
+}
+
+func render(t *testing.T, g *Generator, shell string) string {
+	t.Helper()
+	var b strings.Builder
+	if err := g.Write(&b, shell); err != nil {
+		t.Fatalf("Write(%s): %v", shell, err)
+	}
+	return b.String()
+}
+
+func TestWrite_Zsh(t *testing.T) {
+	out := render(t, newTestGenerator(t), models.ShellZsh)
+
+	for _, want := range []string{
+		`export HOMEBREW_PREFIX="/opt/brew"`,
+		`export PATH="/opt/brew/bin${PATH:+:$PATH}"`,
+		`fpath=("$HOMEBREW_PREFIX/share/zsh/site-functions" $fpath)`,
+		"if command -v \"zoxide\" >/dev/null 2>&1; then\n  eval \"$(zoxide init zsh)\"\nfi",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"starship", "RIPGREP", "podman"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("unexpected %q in:\n%s", unwanted, out)
+		}
+	}
+}
+
+func TestWrite_BashAndFish(t *testing.T) {
+	g := newTestGenerator(t)
+
+	bash := render(t, g, models.ShellBash)
+	if !strings.Contains(bash, `if command -v "rg" >/dev/null`) || !strings.Contains(bash, "export RIPGREP_CONFIG_PATH") {
+		t.Errorf("expected ripgrep's init guarded by its binary:\n%s", bash)
+	}
+	if !strings.Contains(bash, "bash_completion.sh") || !strings.Contains(bash, "zoxide init zsh") {
+		t.Errorf("expected completions and the shorthand init line:\n%s", bash)
+	}
+
+	fish := render(t, g, models.ShellFish)
+	if !strings.Contains(fish, `set -gx HOMEBREW_PREFIX "/opt/brew"`) || !strings.Contains(fish, "starship init fish | source") {
+		t.Errorf("unexpected fish snippet:\n%s", fish)
+	}
+	if strings.Contains(fish, "zoxide") {
+		t.Errorf("the shorthand must not apply to fish:\n%s", fish)
+	}
+}
+
+func TestWrite_UnsupportedShell(t *testing.T) {
+	if err := newTestGenerator(t).Write(&strings.Builder{}, "tcsh"); err == nil {
+		t.Fatal("expected an error for tcsh")
+	}
+}
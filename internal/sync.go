@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/syncer"
+
+	"github.com/spf13/cobra"
+)
+
+func NewSyncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Make this machine match keg.yml",
+		Long: `Install the missing core packages of keg.yml and upgrade the outdated ones,
+in one run. With --prune, also uninstall the top-level packages keg.yml does
+not declare (see 'keg adopt' to add them instead); keg asks first unless
+--yes is given.
+
+Examples:
+  keg sync                   # Install + upgrade
+  keg sync --prune           # ...and uninstall stray packages, after confirmation
+  keg sync --prune --dry-run # Show what would change`,
+		Args:        cobra.NoArgs,
+		Annotations: dryRunnable,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
+			if err != nil {
+				return err
+			}
+
+			prune, err := cmd.Flags().GetBool("prune")
+			if err != nil {
+				return err
+			}
+			yes, err := cmd.Flags().GetBool("yes")
+			if err != nil {
+				return err
+			}
+
+			return syncer.New(cfg, nil).Execute(prune, yes)
+		},
+	}
+
+	cmd.Flags().Bool("prune", false, "Uninstall top-level packages that are not in keg.yml")
+	cmd.Flags().BoolP("yes", "y", false, "Prune without asking")
+
+	return cmd
+}
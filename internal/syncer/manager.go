@@ -0,0 +1,92 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MrSnakeDoc/keg/internal/adopt"
+	"github.com/MrSnakeDoc/keg/internal/core"
+	"github.com/MrSnakeDoc/keg/internal/install"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/prompter"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+	"github.com/MrSnakeDoc/keg/internal/uninstall"
+	"github.com/MrSnakeDoc/keg/internal/upgrade"
+	"github.com/MrSnakeDoc/keg/internal/utils"
+)
+
+// Syncer runs install, upgrade and optionally prune on a single Base, so
+// each step sees what the previous ones did without asking brew again.
+type Syncer struct {
+	*core.Base
+	Prompter prompter.Prompter
+}
+
+func New(config *models.Config, r runner.CommandRunner) *Syncer {
+	if r == nil {
+		r = runner.New()
+	}
+
+	return &Syncer{
+		Base:     core.NewBase(config, r),
+		Prompter: prompter.New(os.Stdin, os.Stdout),
+	}
+}
+
+// Execute installs the missing core packages of keg.yml and upgrades the
+// outdated ones. With prune, it then uninstalls the top-level packages
+// keg.yml does not declare, after confirmation unless yes is set. With
+// KeepGoing, a step that failed does not stop the next ones.
+func (s *Syncer) Execute(prune, yes bool) error {
+	err := (&install.Installer{Base: s.Base}).Execute(nil, false, false, false, "", nil, false)
+	if err != nil && !s.KeepGoing {
+		return err
+	}
+	if uerr := (&upgrade.Upgrader{Base: s.Base}).Execute(nil, false, false, nil); uerr != nil {
+		if !s.KeepGoing {
+			return uerr
+		}
+		err = errors.Join(err, uerr)
+	}
+	if !prune {
+		return err
+	}
+	return errors.Join(err, s.prune(yes))
+}
+
+// selfFormula is the formula keg is installed as from its tap. Prune never
+// removes it, whether keg.yml lists it or not.
+const selfFormula = "keg"
+
+func (s *Syncer) prune(yes bool) error {
+	unmanaged, err := (&adopt.Adopter{Base: s.Base}).Unmanaged()
+	if err != nil {
+		return err
+	}
+	stray := utils.Filter(unmanaged, func(n string) bool {
+		return (&models.Package{Command: n}).FormulaName() != selfFormula
+	})
+	if len(stray) == 0 {
+		logger.Success("No package installed outside of keg.yml")
+		return nil
+	}
+
+	logger.Warn("Installed outside of keg.yml: %s", strings.Join(stray, ", "))
+	// A dry run uninstalls nothing, so there is nothing to confirm
+	if !yes && !runner.IsDryRun(s.Runner) {
+		ok, err := s.Prompter.Confirm(fmt.Sprintf("Uninstall these %d package(s)?", len(stray)))
+		if err != nil {
+			return fmt.Errorf("failed to read user input: %w", err)
+		}
+		if !ok {
+			logger.Info("Nothing pruned; 'keg adopt' adds them to keg.yml instead")
+			return nil
+		}
+	}
+
+	names := utils.Map(stray, func(n string) string { return (&models.Package{Command: n}).FormulaName() })
+	return (&uninstall.Uninstall{Base: s.Base}).Prune(names)
+}
@@ -0,0 +1,118 @@
+package syncer
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/models"
+	"github.com/MrSnakeDoc/keg/internal/runner"
+)
+
+func TestMain(m *testing.M) {
+	logger.UseTestMode()
+	os.Exit(m.Run())
+}
+
+type answer bool
+
+func (a answer) Confirm(string) (bool, error) { return bool(a), nil }
+func (answer) Prompt(string) (string, error)  { return "", nil }
+
+func newTestSyncer(t *testing.T, confirm bool) (*Syncer, *runner.MockRunner) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", home)
+
+	mr := runner.NewMockRunner()
+	mr.AddResponse("brew|list|--formula|-1", []byte("bat\nhtop\nlibyaml\nterraform\n"), nil)
+	mr.AddResponse("brew|leaves", []byte("bat\nhtop\nhashicorp/tap/terraform\nmrsnakedoc/tap/keg\n"), nil)
+	mr.AddResponse("brew|outdated|--json=v2", []byte(`{"formulae":[{"name":"bat","installed_versions":["0.23.0"],"current_version":"0.24.0"}],"casks":[]}`), nil)
+
+	cfg := &models.Config{Packages: []models.Package{
+		{Command: "bat"},
+		{Command: "jq"},
+		{Command: "fd", Optional: true},
+	}}
+	s := New(cfg, mr)
+	s.Prompter = answer(confirm)
+	return s, mr
+}
+
+func TestExecute_InstallsAndUpgrades(t *testing.T) {
+	s, mr := newTestSyncer(t, true)
+
+	if err := s.Execute(false, false); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !mr.VerifyCommand("brew", "install", "jq") {
+		t.Error("expected jq to be installed")
+	}
+	if mr.VerifyCommand("brew", "install", "fd") {
+		t.Error("optional packages are not synced")
+	}
+	if !mr.VerifyCommand("brew", "upgrade", "bat") {
+		t.Error("expected bat to be upgraded")
+	}
+	if mr.VerifyCommand("brew", "uninstall", "htop") {
+		t.Error("nothing is uninstalled without --prune")
+	}
+}
+
+func TestExecute_Prune(t *testing.T) {
+	tests := []struct {
+		name    string
+		confirm bool
+		yes     bool
+		pruned  bool
+	}{
+		{name: "confirmed", confirm: true, pruned: true},
+		{name: "declined", confirm: false, pruned: false},
+		{name: "yes skips the question", confirm: false, yes: true, pruned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := newTestSyncer(t, tt.confirm)
+
+			if err := s.Execute(true, tt.yes); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if got := mr.VerifyCommand("brew", "uninstall", "terraform", "htop"); got != tt.pruned {
+				t.Errorf("uninstall terraform and htop: got %v, want %v", got, tt.pruned)
+			}
+			if mr.VerifyCommand("brew", "uninstall", "bat") || mr.VerifyCommand("brew", "uninstall", "libyaml") {
+				t.Error("only top-level packages missing from keg.yml are pruned")
+			}
+			for _, c := range mr.Commands {
+				if c.Name == "brew" && c.Args[0] == "uninstall" && slices.Contains(c.Args, "keg") {
+					t.Errorf("keg must never prune itself: %v", c.Args)
+				}
+			}
+		})
+	}
+}
+
+func TestExecute_KeepGoing(t *testing.T) {
+	s, mr := newTestSyncer(t, true)
+	mr.AddResponse("brew|install|jq", nil, errors.New("exit status 1"))
+
+	if err := s.Execute(false, false); err == nil {
+		t.Fatal("expected the jq failure")
+	}
+	if mr.VerifyCommand("brew", "upgrade", "bat") {
+		t.Error("a failed install stops the sync")
+	}
+
+	s, mr = newTestSyncer(t, true)
+	mr.AddResponse("brew|install|jq", nil, errors.New("exit status 1"))
+	s.KeepGoing = true
+	if err := s.Execute(false, false); err == nil {
+		t.Fatal("expected the jq failure")
+	}
+	if !mr.VerifyCommand("brew", "upgrade", "bat") {
+		t.Error("with KeepGoing, bat is upgraded despite the failed install")
+	}
+}
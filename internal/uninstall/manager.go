@@ -17,7 +17,7 @@ var saveConfig = globalconfig.SaveConfig
 
 func New(config *models.Config, r runner.CommandRunner) *Uninstall {
 	if r == nil {
-		r = &runner.ExecRunner{}
+		r = runner.New()
 	}
 
 	return &Uninstall{
@@ -25,7 +25,7 @@ func New(config *models.Config, r runner.CommandRunner) *Uninstall {
 	}
 }
 
-func (u *Uninstall) Execute(args []string, all bool, remove bool, force bool) error {
+func (u *Uninstall) Execute(args []string, all bool, remove bool, force bool, groups []string) error {
 	opts := core.DefaultPackageHandlerOptions(core.PackageAction{
 		Name:       "Uninstalling",
 		ActionVerb: "uninstall",
@@ -40,6 +40,14 @@ func (u *Uninstall) Execute(args []string, all bool, remove bool, force bool) er
 		opts.FilterFunc = func(_ *models.Package) bool { return true }
 	}
 
+	// Group mode
+	if len(groups) > 0 {
+		if err := core.ValidateGroups(u.Config, groups); err != nil {
+			return err
+		}
+		opts.FilterFunc = core.GroupFilter(groups)
+	}
+
 	// Phase 1: uninstall
 	if err := u.HandlePackages(opts); err != nil {
 		if !remove {
@@ -51,21 +59,7 @@ func (u *Uninstall) Execute(args []string, all bool, remove bool, force bool) er
 		return nil
 	}
 
-	var toRemove []string
-
-	if all {
-		for i := range u.Config.Packages {
-			p := &u.Config.Packages[i]
-			toRemove = append(toRemove, p.Command)
-		}
-	} else {
-		for _, name := range args {
-			if pkg, found := u.FindPackage(name); found {
-				toRemove = append(toRemove, pkg.Command)
-			}
-		}
-	}
-
+	toRemove := u.removable(args, opts.FilterFunc, all || len(groups) > 0)
 	if len(toRemove) == 0 {
 		return nil
 	}
@@ -84,3 +78,43 @@ func (u *Uninstall) Execute(args []string, all bool, remove bool, force bool) er
 
 	return nil
 }
+
+// removable returns the commands to drop from keg.yml: the filtered packages
+// in bulk mode, otherwise the named ones. Included packages are left alone.
+func (u *Uninstall) removable(args []string, filter func(*models.Package) bool, bulk bool) []string {
+	var out []string
+	if bulk {
+		for i := range u.Config.Packages {
+			p := &u.Config.Packages[i]
+			if filter(p) && p.Origin == "" {
+				out = append(out, p.Command)
+			}
+		}
+		return out
+	}
+
+	for _, name := range args {
+		pkg, found := u.FindPackage(name)
+		if !found {
+			continue
+		}
+		if pkg.Origin != "" {
+			logger.Warn("%s comes from include %s, remove it there", name, pkg.Origin)
+			continue
+		}
+		out = append(out, pkg.Command)
+	}
+	return out
+}
+
+// Prune uninstalls packages keg.yml does not declare, like the strays
+// `keg sync --prune` finds. keg.yml is left as is.
+func (u *Uninstall) Prune(names []string) error {
+	opts := core.DefaultPackageHandlerOptions(core.PackageAction{
+		Name:       "Uninstalling",
+		ActionVerb: "uninstall",
+	})
+	opts.Packages = names
+	opts.AllowAdHoc = true
+	return u.HandlePackages(opts)
+}
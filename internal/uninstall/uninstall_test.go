@@ -14,6 +14,7 @@ var executeTestCases = []struct {
 	all           bool
 	remove        bool
 	force         bool
+	groups        []string
 	expectedError string
 }{
 	{
@@ -35,6 +36,16 @@ var executeTestCases = []struct {
 		remove: true,
 		force:  true,
 	},
+	{
+		name:   "Uninstall and remove a group",
+		groups: []string{"k8s"},
+		remove: true,
+	},
+	{
+		name:          "Uninstall unknown group",
+		groups:        []string{"nope"},
+		expectedError: "no package in configuration belongs to group: nope",
+	},
 }
 
 func TestUninstaller_Execute(t *testing.T) {
@@ -50,14 +61,14 @@ func TestUninstaller_Execute(t *testing.T) {
 			config := &models.Config{
 				Packages: []models.Package{
 					{Command: "pkg1"},
-					{Command: "pkg2"},
+					{Command: "pkg2", Groups: []string{"k8s"}},
 					{Command: "pkg3", Optional: true},
 				},
 			}
 
 			uninstaller := New(config, mockRunner)
 
-			err := uninstaller.Execute(tt.args, tt.all, tt.remove, tt.force)
+			err := uninstaller.Execute(tt.args, tt.all, tt.remove, tt.force, tt.groups)
 
 			if tt.expectedError != "" {
 				if err == nil {
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"github.com/MrSnakeDoc/keg/internal/errs"
 	"github.com/MrSnakeDoc/keg/internal/middleware"
 	"github.com/MrSnakeDoc/keg/internal/models"
 	"github.com/MrSnakeDoc/keg/internal/upgrade"
@@ -18,7 +19,9 @@ Examples:
   keg upgrade            		# Upgrades all packages from config
   keg upgrade bat fzf    		# Upgrades specific packages
   keg upgrade --check/-c 		# Checks for available upgrades
-  keg upgrade --check/-c bat 	# Checks upgrades for specific package`,
+  keg upgrade --check/-c bat 	# Checks upgrades for specific package
+  keg upgrade --group k8s 	# Upgrades the packages of the k8s group`,
+		Annotations: dryRunnable,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := middleware.Get[*models.Config](cmd, middleware.CtxKeyConfig)
 			if err != nil {
@@ -36,13 +39,26 @@ Examples:
 				return err
 			}
 
-			return upgrade.New(cfg, nil).Execute(args, checkOnly, all)
+			groups, err := cmd.Flags().GetStringSlice("group")
+			if err != nil {
+				return err
+			}
+
+			if all && len(groups) > 0 {
+				return middleware.FlagComboError(errs.AllWithGroup, "Upgrade", "upgrade")
+			}
+			if len(groups) > 0 && len(args) > 0 {
+				return middleware.FlagComboError(errs.GroupWithNamedPackages, "Upgrade", "upgrade")
+			}
+
+			return upgrade.New(cfg, nil).Execute(args, checkOnly, all, groups)
 		},
 	}
 
 	// Add flags
 	cmd.Flags().BoolP("check", "c", false, "Check for available updates without installing them")
 	cmd.Flags().BoolP("all", "a", false, "Upgrade all packages, including dependencies")
+	cmd.Flags().StringSliceP("group", "g", nil, "Only upgrade the packages of these groups")
 
 	return cmd
 }
@@ -20,14 +20,20 @@ type Upgrader struct {
 
 func New(config *models.Config, r runner.CommandRunner) *Upgrader {
 	if r == nil {
-		r = &runner.ExecRunner{}
+		r = runner.New()
 	}
 	return &Upgrader{Base: core.NewBase(config, r)}
 }
 
-func (u *Upgrader) Execute(args []string, checkOnly bool, all bool) error {
+func (u *Upgrader) Execute(args []string, checkOnly bool, all bool, groups []string) error {
+	if len(groups) > 0 {
+		if err := core.ValidateGroups(u.Config, groups); err != nil {
+			return err
+		}
+	}
+
 	if checkOnly {
-		return u.CheckUpgrades(args, all)
+		return u.CheckUpgrades(args, all, groups)
 	}
 
 	opts := core.DefaultPackageHandlerOptions(core.PackageAction{
@@ -63,6 +69,9 @@ func (u *Upgrader) Execute(args []string, checkOnly bool, all bool) error {
 	}
 
 	opts.FilterFunc = func(p *models.Package) bool {
+		if len(groups) > 0 && !p.InAnyGroup(groups) {
+			return false
+		}
 		if !p.Optional {
 			return true
 		}
@@ -76,20 +85,37 @@ func (u *Upgrader) Execute(args []string, checkOnly bool, all bool) error {
    Helpers for --check output
    =========================== */
 
-func (u *Upgrader) buildConfiguredSets() (configured []string, cfgSet map[string]struct{}, optionalSet map[string]bool) {
-	configured = utils.Map(u.Config.Packages, func(p models.Package) string {
+// configuredSets groups the manifest lookups used to classify check rows.
+type configuredSets struct {
+	cfg      map[string]struct{}
+	optional map[string]bool
+	pinned   map[string]string // name -> declared version ("" when only `pin: true`)
+}
+
+func (u *Upgrader) buildConfiguredSets(groups []string) (configured []string, sets configuredSets) {
+	inScope := u.Config.Packages
+	if len(groups) > 0 {
+		inScope = utils.Filter(inScope, func(p models.Package) bool { return p.InAnyGroup(groups) })
+	}
+	configured = utils.Map(inScope, func(p models.Package) string {
 		return u.GetPackageName(&p)
 	})
-	cfgSet = make(map[string]struct{}, len(configured))
-	optionalSet = make(map[string]bool, len(configured))
+	sets = configuredSets{
+		cfg:      make(map[string]struct{}, len(configured)),
+		optional: make(map[string]bool, len(configured)),
+		pinned:   make(map[string]string),
+	}
 	for _, p := range u.Config.Packages {
 		name := u.GetPackageName(&p)
-		cfgSet[name] = struct{}{}
+		sets.cfg[name] = struct{}{}
 		if p.Optional {
-			optionalSet[name] = true
+			sets.optional[name] = true
+		}
+		if p.IsPinned() {
+			sets.pinned[name] = p.Version
 		}
 	}
-	return configured, cfgSet, optionalSet
+	return configured, sets
 }
 
 func computeDeps(st *brew.BrewState, cfgSet map[string]struct{}) []string {
@@ -132,8 +158,7 @@ func (u *Upgrader) renderCheckTable(
 	title string,
 	names []string,
 	st *brew.BrewState,
-	cfgSet map[string]struct{},
-	optionalSet map[string]bool,
+	sets configuredSets,
 	vers map[string]versions.Info,
 ) error {
 	if len(names) == 0 {
@@ -157,39 +182,8 @@ func (u *Upgrader) renderCheckTable(
 	rows := make([]row, 0, len(names))
 
 	for _, name := range names {
-		var versionCell, statusCell, typeCell, rawType string
-
-		// status & versions
-		if _, ok := st.Installed[name]; !ok {
-			versionCell = "—"
-			statusCell = p.Warning("not installed")
-		} else if v, out := st.Outdated[name]; out {
-			oldV := p.Error(v.InstalledVersion)
-			newV := p.Success(v.LatestVersion)
-			versionCell = fmt.Sprintf("%s -> %s", oldV, newV)
-			statusCell = p.Error("outdated")
-		} else {
-			if info, ok := vers[name]; ok && info.Installed != "" {
-				versionCell = p.Success(info.Installed)
-			} else {
-				versionCell = p.Success("current")
-			}
-			statusCell = p.Success("up to date")
-		}
-
-		// type
-		if _, ok := cfgSet[name]; ok {
-			if optionalSet[name] {
-				typeCell = p.Warning("optional")
-				rawType = "optional"
-			} else {
-				typeCell = "core"
-				rawType = "core"
-			}
-		} else {
-			typeCell = p.Warning("dep")
-			rawType = "dep"
-		}
+		versionCell, statusCell := checkStatusCells(p, name, st, sets, vers)
+		typeCell, rawType := checkTypeCell(p, name, sets)
 
 		rows = append(rows, row{
 			Name:    name,
@@ -215,36 +209,74 @@ func (u *Upgrader) renderCheckTable(
 	return nil
 }
 
+// checkStatusCells returns the version and status columns of name.
+func checkStatusCells(p *printer.ColorPrinter, name string, st *brew.BrewState, sets configuredSets, vers map[string]versions.Info) (string, string) {
+	pinVersion, pinned := sets.pinned[name]
+	if _, ok := st.Installed[name]; !ok {
+		return "—", p.Warning("not installed")
+	}
+	if pinned {
+		versionCell := "current"
+		if info, ok := vers[name]; ok && info.Installed != "" {
+			versionCell = info.Installed
+		}
+		if pinVersion != "" {
+			versionCell = fmt.Sprintf("%s (pin %s)", versionCell, pinVersion)
+		}
+		return versionCell, p.Info("pinned")
+	}
+	if v, out := st.Outdated[name]; out {
+		oldV := p.Error(v.InstalledVersion)
+		newV := p.Success(v.LatestVersion)
+		return fmt.Sprintf("%s -> %s", oldV, newV), p.Error("outdated")
+	}
+	if info, ok := vers[name]; ok && info.Installed != "" {
+		return p.Success(info.Installed), p.Success("up to date")
+	}
+	return p.Success("current"), p.Success("up to date")
+}
+
+// checkTypeCell returns the colored type column of name and its raw value.
+func checkTypeCell(p *printer.ColorPrinter, name string, sets configuredSets) (string, string) {
+	if _, ok := sets.cfg[name]; !ok {
+		return p.Warning("dep"), "dep"
+	}
+	if sets.optional[name] {
+		return p.Warning("optional"), "optional"
+	}
+	return "core", "core"
+}
+
 /* ===========================
    CheckUpgrades (with helpers)
    =========================== */
 
-func (u *Upgrader) CheckUpgrades(args []string, all bool) error {
+func (u *Upgrader) CheckUpgrades(args []string, all bool, groups []string) error {
 	state, err := brew.FetchState(u.Runner)
 	if err != nil {
 		return err
 	}
 
-	configured, cfgSet, optionalSet := u.buildConfiguredSets()
-	deps := computeDeps(state, cfgSet)
+	configured, sets := u.buildConfiguredSets(groups)
+	deps := computeDeps(state, sets.cfg)
 
 	// selection
 	if len(args) > 0 {
 		names := u.normalizeArgs(args)
 		vers := u.resolveVersions(names)
-		return u.renderCheckTable("", names, state, cfgSet, optionalSet, vers)
+		return u.renderCheckTable("", names, state, sets, vers)
 	}
 
 	// manifest table
 	versManifest := u.resolveVersions(configured)
-	if err := u.renderCheckTable("", configured, state, cfgSet, optionalSet, versManifest); err != nil {
+	if err := u.renderCheckTable("", configured, state, sets, versManifest); err != nil {
 		return err
 	}
 
 	// deps table when --all
 	if all && len(deps) > 0 {
 		versDeps := u.resolveVersions(deps)
-		if err := u.renderCheckTable("Dependencies:", deps, state, cfgSet, optionalSet, versDeps); err != nil {
+		if err := u.renderCheckTable("Dependencies:", deps, state, sets, versDeps); err != nil {
 			return err
 		}
 	}
@@ -130,7 +130,7 @@ func TestCheckUpgrades_ManifestOnly(t *testing.T) {
 	cfg := models.Config{Packages: []models.Package{{Command: "foo"}}}
 	up := New(&cfg, mr)
 
-	if err := up.CheckUpgrades(nil, false); err != nil {
+	if err := up.CheckUpgrades(nil, false, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 }
@@ -146,7 +146,7 @@ func TestCheckUpgrades_WithAll_IncludesDeps(t *testing.T) {
 	cfg := models.Config{Packages: []models.Package{{Command: "foo"}}}
 	up := New(&cfg, mr)
 
-	if err := up.CheckUpgrades(nil, true); err != nil {
+	if err := up.CheckUpgrades(nil, true, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 }
@@ -165,10 +165,10 @@ func TestCheckUpgrades_WithArgs_SingleAndMultiple(t *testing.T) {
 	}}
 	up := New(&cfg, mr)
 
-	if err := up.CheckUpgrades([]string{"foo"}, false); err != nil {
+	if err := up.CheckUpgrades([]string{"foo"}, false, nil); err != nil {
 		t.Fatalf("unexpected err(single): %v", err)
 	}
-	if err := up.CheckUpgrades([]string{"foo", "bar"}, false); err != nil {
+	if err := up.CheckUpgrades([]string{"foo", "bar"}, false, nil); err != nil {
 		t.Fatalf("unexpected err(multi): %v", err)
 	}
 }
@@ -189,7 +189,7 @@ func TestExecute_WithArgs_UpgradesSingle(t *testing.T) {
 
 	up := New(&cfg, mr)
 
-	if err := up.Execute([]string{"foo"}, false, false); err != nil {
+	if err := up.Execute([]string{"foo"}, false, false, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 	if !sawUpgrade(mr, "foo") {
@@ -215,7 +215,7 @@ func TestExecute_WithMultipleArgs_UpgradesAll(t *testing.T) {
 
 	up := New(&cfg, mr)
 
-	if err := up.Execute([]string{"foo", "bar", "baz"}, false, false); err != nil {
+	if err := up.Execute([]string{"foo", "bar", "baz"}, false, false, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 
@@ -247,7 +247,7 @@ func TestExecute_All_ManifestOnly(t *testing.T) {
 
 	up := New(&cfg, mr)
 
-	if err := up.Execute(nil, false, true); err != nil {
+	if err := up.Execute(nil, false, true, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 	if !sawUpgrade(mr, "foo") || !sawUpgrade(mr, "bar") {
@@ -269,7 +269,7 @@ func TestExecute_All_IncludesDeps(t *testing.T) {
 
 	up := New(&cfg, mr)
 
-	if err := up.Execute(nil, false, true); err != nil {
+	if err := up.Execute(nil, false, true, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 
@@ -293,7 +293,7 @@ func TestExecute_OptionalNotInstalled_IsSkipped(t *testing.T) {
 
 	up := New(&cfg, mr)
 
-	if err := up.Execute(nil, false, false); err != nil {
+	if err := up.Execute(nil, false, false, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 
@@ -314,7 +314,7 @@ func TestExecute_AdHoc_Targeted(t *testing.T) {
 
 	up := New(&cfg, mr)
 
-	if err := up.Execute([]string{"dep"}, false, false); err != nil {
+	if err := up.Execute([]string{"dep"}, false, false, nil); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 
@@ -333,7 +333,7 @@ func TestExecute_AdHoc_Targeted_NotInstalled(t *testing.T) {
 
 	up := New(&cfg, mr)
 
-	err := up.Execute([]string{"ghost"}, false, false)
+	err := up.Execute([]string{"ghost"}, false, false, nil)
 	if err == nil {
 		t.Fatalf("expected error for unknown ad-hoc pkg, got nil")
 	}
@@ -341,3 +341,32 @@ func TestExecute_AdHoc_Targeted_NotInstalled(t *testing.T) {
 		t.Fatalf("expected 'package not found' error, got: %v", err)
 	}
 }
+
+func TestExecute_Pinned_IsSkipped(t *testing.T) {
+	withIsolatedState(t)
+	cfg := models.Config{Packages: []models.Package{
+		{Command: "foo", Pin: true},
+		{Command: "bar", Version: "1.0"},
+		{Command: "baz"},
+	}}
+	mr := runner.NewMockRunner()
+
+	primeInstalled(mr, "foo", "bar", "baz")
+	writeOutdatedCache(t, map[string][2]string{
+		"foo": {"1.0.0", "1.1.0"},
+		"bar": {"1.0.0", "1.1.0"},
+		"baz": {"1.0.0", "1.1.0"},
+	})
+
+	up := New(&cfg, mr)
+
+	if err := up.Execute(nil, false, false, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if sawUpgrade(mr, "foo") || sawUpgrade(mr, "bar") {
+		t.Fatalf("pinned packages must not be upgraded, got: %#v", mr.Commands)
+	}
+	if !sawUpgrade(mr, "baz") {
+		t.Fatalf("expected 'brew upgrade baz', got: %#v", mr.Commands)
+	}
+}
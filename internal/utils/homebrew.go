@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -25,21 +26,64 @@ func IsHomebrewInstalled() bool {
 	return CommandExists("brew")
 }
 
-func SetHomebrewPath() error {
-	homebrewPath := "/home/linuxbrew/.linuxbrew"
+// DefaultHomebrewPrefix is where Homebrew lives on Linux.
+const DefaultHomebrewPrefix = "/home/linuxbrew/.linuxbrew"
+
+// HomebrewPrefix returns $HOMEBREW_PREFIX when set, otherwise DefaultHomebrewPrefix.
+func HomebrewPrefix() string {
+	if p := strings.TrimSpace(os.Getenv("HOMEBREW_PREFIX")); p != "" {
+		return p
+	}
+	return DefaultHomebrewPrefix
+}
 
-	envVars := map[string]string{
-		"HOMEBREW_PREFIX":     homebrewPath,
-		"HOMEBREW_CELLAR":     homebrewPath + "/Cellar",
-		"HOMEBREW_REPOSITORY": homebrewPath + "/Homebrew",
-		"PATH":                homebrewPath + "/bin:" + os.Getenv("PATH"),
-		"MANPATH":             homebrewPath + "/share/man:" + os.Getenv("MANPATH"),
-		"INFOPATH":            homebrewPath + "/share/info:" + os.Getenv("INFOPATH"),
+// ResolveBinary looks an executable up on PATH, then in the brew prefix bin
+// directory (useful right after an install, before the shell is refreshed).
+// It returns the resolved path and whether the binary was found.
+func ResolveBinary(name string) (string, bool) {
+	if path, err := LookForFileInPath(name); err == nil {
+		return path, true
+	}
+	candidate := filepath.Join(HomebrewPrefix(), "bin", name)
+	if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+		return candidate, true
 	}
+	return "", false
+}
+
+// EnvVar is a variable Homebrew needs in the environment.
+type EnvVar struct {
+	Name  string
+	Value string
+	// List variables (PATH, MANPATH…) get Value prepended to their
+	// current value instead of replaced.
+	List bool
+}
+
+// HomebrewEnv returns the variables that make the Homebrew installed at
+// prefix usable, in the order `brew shellenv` sets them.
+func HomebrewEnv(prefix string) []EnvVar {
+	return []EnvVar{
+		{Name: "HOMEBREW_PREFIX", Value: prefix},
+		{Name: "HOMEBREW_CELLAR", Value: prefix + "/Cellar"},
+		{Name: "HOMEBREW_REPOSITORY", Value: prefix + "/Homebrew"},
+		{Name: "PATH", Value: prefix + "/bin", List: true},
+		{Name: "MANPATH", Value: prefix + "/share/man", List: true},
+		{Name: "INFOPATH", Value: prefix + "/share/info", List: true},
+	}
+}
 
-	for key, value := range envVars {
-		if err := os.Setenv(key, value); err != nil {
-			return fmt.Errorf("failed to set %s: %w", key, err)
+// SetHomebrewPath sets the variables of HomebrewEnv for the keg process, so
+// a freshly installed brew can be used without a new shell. It keeps the
+// prefix of HomebrewPrefix, which $HOMEBREW_PREFIX can move.
+func SetHomebrewPath() error {
+	for _, v := range HomebrewEnv(HomebrewPrefix()) {
+		value := v.Value
+		if v.List {
+			value += ":" + os.Getenv(v.Name)
+		}
+		if err := os.Setenv(v.Name, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", v.Name, err)
 		}
 	}
 
@@ -71,6 +115,61 @@ func InstalledSet(r runner.CommandRunner) (map[string]bool, error) {
 	return m, nil
 }
 
+// LeavesSet returns the installed formulae that no other installed formula
+// depends on, as reported by `brew leaves`. Tap formulae keep their
+// qualified name ("owner/tap/name").
+func LeavesSet(r runner.CommandRunner) (map[string]bool, error) {
+	if r == nil {
+		r = &runner.ExecRunner{}
+	}
+
+	out, err := r.Run(context.Background(), 60*time.Second, runner.Capture, "brew", "leaves")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch leaves: %w", err)
+	}
+
+	m := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			m[name] = true
+		}
+	}
+	return m, nil
+}
+
+// TappedSet returns a fast membership map of the taps brew already knows about.
+// Keys are normalized with NormalizeTap.
+func TappedSet(r runner.CommandRunner) (map[string]bool, error) {
+	if r == nil {
+		r = &runner.ExecRunner{}
+	}
+
+	out, err := r.Run(context.Background(), 60*time.Second, runner.Capture, "brew", "tap")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch taps: %w", err)
+	}
+
+	m := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			m[NormalizeTap(name)] = true
+		}
+	}
+	return m, nil
+}
+
+// NormalizeTap lowercases a tap name and drops the "homebrew-" repository
+// prefix, mirroring how brew itself names taps ("owner/homebrew-tools" is
+// reported as "owner/tools").
+func NormalizeTap(tap string) string {
+	tap = strings.ToLower(strings.TrimSpace(tap))
+	owner, repo, ok := strings.Cut(tap, "/")
+	if !ok {
+		return tap
+	}
+	return owner + "/" + strings.TrimPrefix(repo, "homebrew-")
+}
+
 // ListInstalled returns the installed brew formulae as a slice (if you ever need it).
 func ListInstalled(r runner.CommandRunner) ([]string, error) {
 	set, err := InstalledSet(r)
@@ -81,9 +180,19 @@ func ListInstalled(r runner.CommandRunner) ([]string, error) {
 	return Keys(set), nil
 }
 
-// RunBrewCommand executes a brew command and handles warnings
-func RunBrewCommand(r runner.CommandRunner, action, pkg string, ignoreWarnings []string) error {
-	output, err := r.Run(context.Background(), 80*time.Second, runner.Capture, "brew", action, pkg)
+// RunBrewCommand executes a brew command and handles warnings.
+// args go between the action and the package (`brew install --HEAD pkg`),
+// env is added to the environment of brew as "KEY=value" pairs.
+func RunBrewCommand(r runner.CommandRunner, action, pkg string, args, env, ignoreWarnings []string) error {
+	return RunBrewCommandMany(r, action, []string{pkg}, args, env, ignoreWarnings)
+}
+
+// RunBrewCommandMany is RunBrewCommand for several packages in one brew
+// call (`brew install a b c`); each package adds to the timeout.
+func RunBrewCommandMany(r runner.CommandRunner, action string, pkgs, args, env, ignoreWarnings []string) error {
+	ctx := runner.WithEnv(context.Background(), env)
+	cmdArgs := append(append([]string{action}, args...), pkgs...)
+	output, err := r.Run(ctx, time.Duration(max(len(pkgs), 1))*80*time.Second, runner.Capture, "brew", cmdArgs...)
 	if err != nil {
 		errStr := string(output)
 
@@ -93,7 +202,7 @@ func RunBrewCommand(r runner.CommandRunner, action, pkg string, ignoreWarnings [
 			}
 		}
 
-		return fmt.Errorf("brew %s failed for %s: %w", action, pkg, err)
+		return fmt.Errorf("brew %s failed for %s: %w", action, strings.Join(pkgs, " "), err)
 	}
 
 	return nil
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/MrSnakeDoc/keg/internal/models"
+)
+
+// OSReleasePath is where the distro identification is read from.
+var OSReleasePath = "/etc/os-release"
+
+var (
+	hostOnce sync.Once
+	host     *models.Host
+)
+
+// CurrentHost returns the OS, arch, hostname and distro of this machine.
+// It is computed once per process.
+func CurrentHost() *models.Host {
+	hostOnce.Do(func() {
+		name, _ := os.Hostname()
+		id, like := ReadOSRelease(OSReleasePath)
+		host = &models.Host{
+			OS:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+			Hostname:   name,
+			Distro:     id,
+			DistroLike: like,
+		}
+	})
+	return host
+}
+
+// ReadOSRelease returns ID and the ID_LIKE list from an os-release file.
+// Missing files (macOS, containers) yield empty values.
+func ReadOSRelease(path string) (id string, like []string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil
+	}
+	defer func() { _ = f.Close() }()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, val, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		val = strings.ToLower(strings.Trim(val, `"'`))
+		switch key {
+		case "ID":
+			id = val
+		case "ID_LIKE":
+			like = strings.Fields(val)
+		}
+	}
+	return id, like
+}
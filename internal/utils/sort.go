@@ -10,10 +10,12 @@ func TypeRank(t string) int {
 	switch strings.ToLower(t) {
 	case "core":
 		return 0
-	case "dep":
+	case "leaf":
 		return 1
-	case "optional":
+	case "dep":
 		return 2
+	case "optional":
+		return 3
 	default:
 		return 99
 	}
@@ -52,6 +52,17 @@ func IsSemver(v string) bool {
 	return semverPattern.MatchString(v)
 }
 
+// MatchesVersion reports whether a brew version satisfies a declared one.
+// The declared version may be a prefix on component boundaries ("1.5"
+// matches "1.5.7"), and brew revision suffixes ("1.5.7_1") are accepted.
+func MatchesVersion(installed, want string) bool {
+	installed, want = strings.TrimSpace(installed), strings.TrimSpace(want)
+	if want == "" || installed == want {
+		return true
+	}
+	return strings.HasPrefix(installed, want+".") || strings.HasPrefix(installed, want+"_")
+}
+
 func AssetName(version string) string {
 	return fmt.Sprintf("keg_%s_%s_%s", version, runtime.GOOS, runtime.GOARCH)
 }
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/MrSnakeDoc/keg/internal/globalconfig"
+	"github.com/MrSnakeDoc/keg/internal/logger"
+	"github.com/MrSnakeDoc/keg/internal/middleware"
+	"github.com/MrSnakeDoc/keg/internal/validator"
+
+	"github.com/spf13/cobra"
+)
+
+func NewValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Check keg.yml for mistakes",
+		Long: `Check a manifest for unknown keys, wrong types, empty names and
+duplicate commands or binaries. Each problem is reported as file:line:col.
+
+Without a file, the keg.yml from the global configuration is checked.
+Unknown keys are warnings; use --strict to fail on them too.
+
+Examples:
+  keg validate
+  keg validate ./team.yml --strict`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			strict, err := cmd.Flags().GetBool("strict")
+			if err != nil {
+				return err
+			}
+
+			path := ""
+			if len(args) == 1 {
+				path = args[0]
+			} else {
+				pconf, err := globalconfig.LoadPersistentConfig()
+				if err != nil {
+					return fmt.Errorf("missing config: %w", err)
+				}
+				path = pconf.Manifest()
+			}
+
+			diags, err := validator.CheckFile(path)
+			if err != nil {
+				return err
+			}
+
+			for _, d := range diags {
+				if d.Severity == validator.SeverityWarning {
+					logger.Warn("%s", d)
+				} else {
+					logger.LogError("%s", d)
+				}
+			}
+
+			if validator.HasErrors(diags) || (strict && len(diags) > 0) {
+				return middleware.ErrLogged
+			}
+			if len(diags) == 0 {
+				logger.Success("%s is valid", path)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("strict", false, "Treat warnings as errors")
+	return cmd
+}
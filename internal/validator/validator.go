@@ -0,0 +1,431 @@
+package validator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MrSnakeDoc/keg/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single problem found in a manifest, located by line and
+// column (both 1-based, 0 when unknown).
+type Diagnostic struct {
+	File     string
+	Line     int
+	Col      int
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Col, d.Message)
+}
+
+// HasErrors reports whether any diagnostic is an error (not a warning).
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFile reads and validates the manifest at path.
+func CheckFile(path string) ([]Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return Check(path, data), nil
+}
+
+// Check validates a manifest against the models.Config schema.
+//
+// It reports:
+//   - YAML syntax errors
+//   - unknown keys (warnings, with a suggestion when one is close)
+//   - values of the wrong type
+//   - packages without a command
+//   - commands or binaries declared twice
+//   - links without a source or a target
+func Check(file string, data []byte) []Diagnostic {
+	v := &validator{file: file}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		v.add(syntaxLine(err), 0, SeverityError, "%s", strings.TrimPrefix(err.Error(), "yaml: "))
+		return v.diags
+	}
+	if len(doc.Content) == 0 {
+		v.add(1, 1, SeverityError, "manifest is empty")
+		return v.diags
+	}
+
+	root := doc.Content[0]
+	v.walk(root, reflect.TypeOf(models.Config{}), "")
+	v.checkPackages(root)
+	v.checkLinks(root, "")
+
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		if v.diags[i].Line != v.diags[j].Line {
+			return v.diags[i].Line < v.diags[j].Line
+		}
+		return v.diags[i].Col < v.diags[j].Col
+	})
+	return v.diags
+}
+
+type validator struct {
+	file  string
+	diags []Diagnostic
+}
+
+func (v *validator) add(line, col int, sev Severity, format string, args ...any) {
+	v.diags = append(v.diags, Diagnostic{
+		File:     v.file,
+		Line:     line,
+		Col:      col,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) errorAt(n *yaml.Node, format string, args ...any) {
+	v.add(n.Line, n.Column, SeverityError, format, args...)
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// walk checks node against the Go type it will be decoded into, so the
+// schema always follows models without being restated here.
+func (v *validator) walk(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+
+	// Types with a scalar shorthand (Include, StringList) accept a plain value.
+	if n.Kind == yaml.ScalarNode && reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if n.Kind != yaml.ScalarNode {
+			v.errorAt(n, "%s: expected a string, got %s", label(path), kindName(n))
+		}
+
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		v.walkScalar(n, t, path)
+
+	case reflect.Slice:
+		v.walkList(n, t, path)
+
+	case reflect.Map:
+		v.walkMap(n, t, path)
+
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			v.errorAt(n, "%s: expected a mapping, got %s", label(path), kindName(n))
+			return
+		}
+		v.walkStruct(n, t, path)
+	}
+}
+
+func (v *validator) walkScalar(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind != yaml.ScalarNode {
+		v.errorAt(n, "%s: expected a %s, got %s", label(path), t.Kind(), kindName(n))
+		return
+	}
+	if err := n.Decode(reflect.New(t).Interface()); err != nil {
+		v.errorAt(n, "%s: expected a %s, got %q", label(path), t.Kind(), n.Value)
+	}
+}
+
+func (v *validator) walkList(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind != yaml.SequenceNode {
+		v.errorAt(n, "%s: expected a list, got %s", label(path), kindName(n))
+		return
+	}
+	for i, item := range n.Content {
+		v.walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+	}
+}
+
+func (v *validator) walkMap(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind != yaml.MappingNode {
+		v.errorAt(n, "%s: expected a mapping, got %s", label(path), kindName(n))
+		return
+	}
+	v.checkDuplicateKeys(n, path)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		v.walk(n.Content[i+1], t.Elem(), join(path, n.Content[i].Value))
+	}
+}
+
+func (v *validator) walkStruct(n *yaml.Node, t reflect.Type, path string) {
+	fields := yamlFields(t)
+	v.checkDuplicateKeys(n, path)
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		ft, ok := fields[key.Value]
+		if !ok {
+			msg := fmt.Sprintf("unknown key %q", key.Value)
+			if path != "" {
+				msg += " in " + path
+			}
+			if s := suggest(key.Value, fields); s != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+			v.add(key.Line, key.Column, SeverityWarning, "%s", msg)
+			continue
+		}
+		v.walk(val, ft, join(path, key.Value))
+	}
+}
+
+func (v *validator) checkDuplicateKeys(n *yaml.Node, path string) {
+	seen := make(map[string]*yaml.Node, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		if first, dup := seen[key.Value]; dup {
+			v.errorAt(key, "duplicate key %q in %s (first set at line %d)", key.Value, label(path), first.Line)
+			continue
+		}
+		seen[key.Value] = key
+	}
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkPackages reports empty commands and commands or binaries declared
+// more than once, which would make FindPackage pick an arbitrary entry.
+func (v *validator) checkPackages(root *yaml.Node) {
+	pkgs := mappingValue(root, "packages")
+	if pkgs == nil || pkgs.Kind != yaml.SequenceNode {
+		return
+	}
+
+	commands := map[string]*yaml.Node{}
+	binaries := map[string]*yaml.Node{}
+
+	for i, item := range pkgs.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		path := fmt.Sprintf("packages[%d]", i)
+
+		cmd := mappingValue(item, "command")
+		if cmd == nil || strings.TrimSpace(cmd.Value) == "" {
+			at := item
+			if cmd != nil {
+				at = cmd
+			}
+			v.errorAt(at, "%s: command is empty", path)
+		} else if cmd.Kind == yaml.ScalarNode {
+			p := models.Package{Command: strings.TrimSpace(cmd.Value)}
+			name := strings.ToLower(p.FormulaName())
+			if first, dup := commands[name]; dup {
+				v.errorAt(cmd, "%s: duplicate command %q (first declared at line %d)", path, cmd.Value, first.Line)
+			} else {
+				commands[name] = cmd
+			}
+		}
+
+		v.checkBrewOptions(item, path)
+		v.checkLinks(item, path)
+
+		bin := mappingValue(item, "binary")
+		if bin == nil || bin.Kind != yaml.ScalarNode || bin.Tag == "!!null" {
+			continue
+		}
+		if strings.TrimSpace(bin.Value) == "" {
+			v.errorAt(bin, "%s: binary is empty", path)
+			continue
+		}
+		if first, dup := binaries[bin.Value]; dup {
+			v.errorAt(bin, "%s: duplicate binary %q (first declared at line %d)", path, bin.Value, first.Line)
+			continue
+		}
+		binaries[bin.Value] = bin
+	}
+}
+
+// checkBrewOptions rejects args that are not flags, since brew would take
+// them for more formulae to install, and env names brew cannot receive.
+func (v *validator) checkBrewOptions(item *yaml.Node, path string) {
+	if args := mappingValue(item, "args"); args != nil {
+		list := []*yaml.Node{args}
+		if args.Kind == yaml.SequenceNode {
+			list = args.Content
+		}
+		for _, a := range list {
+			if a.Kind == yaml.ScalarNode && a.Tag != "!!null" && !strings.HasPrefix(a.Value, "-") {
+				v.errorAt(a, "%s: args must be flags starting with '-', got %q", path, a.Value)
+			}
+		}
+	}
+
+	if env := mappingValue(item, "env"); env != nil && env.Kind == yaml.MappingNode {
+		for i := 0; i < len(env.Content); i += 2 {
+			if key := env.Content[i]; !envName.MatchString(key.Value) {
+				v.errorAt(key, "%s: invalid environment variable name %q", path, key.Value)
+			}
+		}
+	}
+}
+
+// checkLinks reports links without a source or a target, and sources that
+// climb out of the dotfiles directory.
+func (v *validator) checkLinks(item *yaml.Node, path string) {
+	links := mappingValue(item, "links")
+	if links == nil || links.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, link := range links.Content {
+		if link.Kind != yaml.MappingNode {
+			continue
+		}
+		at := fmt.Sprintf("%s[%d]", join(path, "links"), i)
+		for _, key := range []string{"source", "target"} {
+			if val := mappingValue(link, key); val == nil || strings.TrimSpace(val.Value) == "" {
+				v.errorAt(link, "%s: %s is empty", at, key)
+			}
+		}
+		if src := mappingValue(link, "source"); src != nil && (filepath.IsAbs(src.Value) || escapes(src.Value)) {
+			v.errorAt(src, "%s: source must be inside the dotfiles directory, got %q", at, src.Value)
+		}
+	}
+}
+
+func escapes(path string) bool {
+	clean := filepath.Clean(path)
+	return clean == ".." || strings.HasPrefix(clean, "../")
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlFields maps the yaml keys of a struct to their field types, skipping
+// fields tagged `yaml:"-"`.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	out := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		out[name] = f.Type
+	}
+	return out
+}
+
+// suggest returns the known key closest to key, if it is a likely typo or
+// an abbreviation.
+func suggest(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	for name := range fields {
+		if len(key) >= 3 && strings.HasPrefix(name, strings.ToLower(key)) {
+			return name
+		}
+		if d := distance(strings.ToLower(key), name); d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	if bestDist > 2 {
+		return ""
+	}
+	return best
+}
+
+// distance is the Levenshtein edit distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+var lineRe = regexp.MustCompile(`line (\d+)`)
+
+func syntaxLine(err error) int {
+	if m := lineRe.FindStringSubmatch(err.Error()); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return 0
+}
+
+func kindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.MappingNode:
+		return "a mapping"
+	default:
+		return fmt.Sprintf("%q", n.Value)
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func label(path string) string {
+	if path == "" {
+		return "document"
+	}
+	return path
+}
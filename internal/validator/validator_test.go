@@ -0,0 +1,150 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func messages(diags []Diagnostic) string {
+	out := make([]string, 0, len(diags))
+	for _, d := range diags {
+		out = append(out, d.String())
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestCheck_ValidManifest(t *testing.T) {
+	data := `
+include:
+  - ./team.yml
+  - url: https://example.com/keg.yml
+    sha256: abc
+taps: [hashicorp/tap]
+packages:
+  - command: ripgrep
+    binary: rg
+    optional: true
+    groups: [search]
+  - command: hashicorp/tap/terraform
+    version: 1.9
+    pin: true
+  - command: neovim
+    args: --HEAD
+    env:
+      HOMEBREW_NO_INSTALL_CLEANUP: "1"
+  - command: podman
+    when:
+      arch: arm64
+      distro: [fedora, debian]
+      env:
+        WSL_DISTRO_NAME: ""
+`
+	if diags := Check("keg.yml", []byte(data)); len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got:\n%s", messages(diags))
+	}
+}
+
+func TestCheck_Problems(t *testing.T) {
+	data := `packages:
+  - command: fd
+    optinal: true
+  - command: ripgrep
+    binary: rg
+  - command: fd
+  - command: ""
+  - command: bat
+    binary: rg
+    pin: maybe
+    groups:
+      nested: map
+`
+	diags := Check("keg.yml", []byte(data))
+
+	want := []struct {
+		line, col int
+		sev       Severity
+		msg       string
+	}{
+		{3, 5, SeverityWarning, `unknown key "optinal" in packages[0] (did you mean "optional"?)`},
+		{6, 14, SeverityError, `packages[2]: duplicate command "fd" (first declared at line 2)`},
+		{7, 14, SeverityError, `packages[3]: command is empty`},
+		{9, 13, SeverityError, `packages[4]: duplicate binary "rg" (first declared at line 5)`},
+		{10, 10, SeverityError, `packages[4].pin: expected a bool, got "maybe"`},
+		{12, 7, SeverityError, `packages[4].groups: expected a list, got a mapping`},
+	}
+
+	if len(diags) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %d:\n%s", len(want), len(diags), messages(diags))
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Line != w.line || d.Col != w.col || d.Severity != w.sev || d.Message != w.msg {
+			t.Errorf("diag %d: got %d:%d %s %q, want %d:%d %s %q",
+				i, d.Line, d.Col, d.Severity, d.Message, w.line, w.col, w.sev, w.msg)
+		}
+	}
+	if !HasErrors(diags) {
+		t.Fatal("expected HasErrors to be true")
+	}
+}
+
+func TestCheck_BrewOptions(t *testing.T) {
+	data := `packages:
+  - command: neovim
+    args: [--HEAD, jq]
+    env:
+      HOMEBREW-CACHE: /tmp
+`
+	got := messages(Check("keg.yml", []byte(data)))
+	want := "keg.yml:3:20: packages[0]: args must be flags starting with '-', got \"jq\"\n" +
+		"keg.yml:5:7: packages[0]: invalid environment variable name \"HOMEBREW-CACHE\""
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCheck_Links(t *testing.T) {
+	data := `links:
+  - source: git/gitconfig
+    target: ~/.gitconfig
+  - target: ~/.zshrc
+packages:
+  - command: lazygit
+    links:
+      - source: ../secrets
+        target: ~/.config/lazygit/config.yml
+`
+	got := messages(Check("keg.yml", []byte(data)))
+	want := "keg.yml:4:5: links[1]: source is empty\n" +
+		"keg.yml:8:17: packages[0].links[0]: source must be inside the dotfiles directory, got \"../secrets\""
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCheck_SyntaxError(t *testing.T) {
+	diags := Check("keg.yml", []byte("packages:\n  - command: fd\n   binary: [\n"))
+	if len(diags) != 1 || diags[0].Severity != SeverityError || diags[0].Line == 0 {
+		t.Fatalf("expected one located syntax error, got:\n%s", messages(diags))
+	}
+}
+
+func TestCheckFile_ReportsPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keg.yml")
+	if err := os.WriteFile(path, []byte("packages:\n  - comand: fd\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	diags, err := CheckFile(path)
+	if err != nil {
+		t.Fatalf("CheckFile: %v", err)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("expected unknown key + empty command, got:\n%s", messages(diags))
+	}
+	if !strings.HasPrefix(diags[0].String(), path+":2:5: ") {
+		t.Fatalf("expected file:line:col prefix, got %q", diags[0].String())
+	}
+}
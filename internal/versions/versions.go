@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -207,21 +208,9 @@ func (rv *Resolver) resolveChunk(ctx context.Context, names []string) (map[strin
 	if len(names) == 0 {
 		return map[string]Info{}, nil
 	}
-	// Build command
-	args := append([]string{"info", "--json=v2"}, names...)
-	// Use explicit runner.ModeStdout for clarity and to avoid zero-value assumptions.
-	var mode runner.Mode
-	chCtx, cancel := context.WithTimeout(ctx, rv.ChunkTimeout)
-	defer cancel()
-
-	out, err := rv.Runner.Run(chCtx, rv.ChunkTimeout, mode, "brew", args...)
+	parsed, err := rv.infoChunk(ctx, names)
 	if err != nil {
-		return nil, fmt.Errorf("brew info failed for chunk (%d pkgs): %w", len(names), err)
-	}
-
-	parsed, err := parseBrewInfoJSON(out)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse brew info json: %w", err)
+		return nil, err
 	}
 	now := time.Now()
 	res := make(map[string]Info, len(parsed))
@@ -247,6 +236,94 @@ func (rv *Resolver) resolveChunk(ctx context.Context, names []string) (map[strin
 	return res, nil
 }
 
+// infoChunk runs `brew info --json=v2` for names and indexes the result by
+// short formula name.
+func (rv *Resolver) infoChunk(ctx context.Context, names []string) (map[string]brewFormula, error) {
+	// Build command
+	args := append([]string{"info", "--json=v2"}, names...)
+	// Use explicit runner.ModeStdout for clarity and to avoid zero-value assumptions.
+	var mode runner.Mode
+	chCtx, cancel := context.WithTimeout(ctx, rv.ChunkTimeout)
+	defer cancel()
+
+	out, err := rv.Runner.Run(chCtx, rv.ChunkTimeout, mode, "brew", args...)
+	if err != nil {
+		return nil, fmt.Errorf("brew info failed for chunk (%d pkgs): %w", len(names), err)
+	}
+
+	parsed, err := parseBrewInfoJSON(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse brew info json: %w", err)
+	}
+	return parsed, nil
+}
+
+// -------- Formula details (uncached) --------
+
+// Formula is what brew reports about a formula, beyond versions: the data
+// needed to pin an environment down (see the lock package).
+type Formula struct {
+	Name         string
+	FullName     string
+	Tap          string
+	Installed    string
+	Stable       string
+	BottleSHA256 string // bottle for this platform, empty when unknown
+}
+
+// Formulae fetches fresh details for names (short or owner/tap/formula),
+// bypassing the versions cache. Results are keyed by short formula name;
+// formulae brew does not know are left out.
+func (rv *Resolver) Formulae(ctx context.Context, names []string) (map[string]Formula, error) {
+	names = dedupeAndSort(names)
+	out := make(map[string]Formula, len(names))
+	if len(names) == 0 {
+		return out, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rv.GlobalTimeout)
+	defer cancel()
+
+	tag := BottleTag()
+	for _, chunk := range chunkStrings(names, max(1, rv.MaxBatchSize)) {
+		parsed, err := rv.infoChunk(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		for name, f := range parsed {
+			installed := ""
+			if len(f.Installed) > 0 {
+				installed = f.Installed[0].Version
+			}
+			out[name] = Formula{
+				Name:         name,
+				FullName:     f.FullName,
+				Tap:          f.Tap,
+				Installed:    installed,
+				Stable:       f.Versions.Stable,
+				BottleSHA256: f.Bottle.Stable.sha256For(tag),
+			}
+		}
+	}
+	return out, nil
+}
+
+// BottleTag returns the Homebrew bottle tag of this platform on Linux
+// ("x86_64_linux", "arm64_linux"). It is empty elsewhere: macOS tags carry
+// the OS release name, so only arch-independent bottles are recognized.
+func BottleTag() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64_linux"
+	case "arm64":
+		return "arm64_linux"
+	}
+	return ""
+}
+
 // -------- JSON parsing (minimal schema) --------
 
 type brewInfo struct {
@@ -255,14 +332,37 @@ type brewInfo struct {
 
 type brewFormula struct {
 	Name      string          `json:"name"`
+	FullName  string          `json:"full_name"`
+	Tap       string          `json:"tap"`
 	Versions  brewVersions    `json:"versions"`
 	Installed []brewInstalled `json:"installed"`
+	Bottle    struct {
+		Stable brewBottle `json:"stable"`
+	} `json:"bottle"`
 	// many fields omitted intentionally
 }
 
 type brewVersions struct {
 	Stable string `json:"stable"`
-	// head/bottle omitted
+	// head omitted
+}
+
+type brewBottle struct {
+	Files map[string]struct {
+		Sha256 string `json:"sha256"`
+	} `json:"files"`
+}
+
+// sha256For returns the checksum of the bottle for tag, falling back to an
+// arch-independent ("all") bottle.
+func (b brewBottle) sha256For(tag string) string {
+	if f, ok := b.Files[tag]; ok && tag != "" {
+		return f.Sha256
+	}
+	if f, ok := b.Files["all"]; ok {
+		return f.Sha256
+	}
+	return ""
 }
 
 type brewInstalled struct {